@@ -1,11 +1,14 @@
 package main
 
 import (
+	"archive/zip"
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/akhenakh/regionagogo"
@@ -30,6 +33,16 @@ func (ff *fieldFlag) Set(value string) error {
 	return nil
 }
 
+// formats are the input formats by -format name
+var formats = map[string]regionagogo.Format{
+	"geojson":    regionagogo.FormatGeoJSON,
+	"geojsonseq": regionagogo.FormatGeoJSONSeq,
+	"shp":        regionagogo.FormatShapefile,
+	"kml":        regionagogo.FormatKML,
+	"kmz":        regionagogo.FormatKML,
+	"csv":        regionagogo.FormatCSV,
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -45,14 +58,30 @@ func main() {
 	var renameFields fieldFlag
 	flag.Var(&renameFields, "renameFields", "List of fields to be renamed on the fly as a property, eg NAME_EN=name\n\tnote NAME_EN needs to be in importFields even if it will be renamed")
 
-	filename := flag.String("filename", "", "A geojson file")
+	filename := flag.String("filename", "", "A geojson file, stdin if empty")
+	format := flag.String("format", "geojson", "Input format, geojson, geojsonseq for one feature per line, GeoJSON Text Sequences or NDJSON, shp for a shapefile, the .dbf is read next to the .shp, kml, kmz or csv")
+	geometryColumn := flag.String("geometryColumn", "geom", "CSV column of the WKT or hex encoded WKB geometries")
 	dbpath := flag.String("dbpath", "", "Database path")
 	debug := flag.Bool("debug", false, "Enable debug")
 	featureImport := flag.Bool("featureImport", false, "the GeoJSON is a feature not a featureCollection")
+	keyField := flag.String("keyField", "", "GeoJSON property used as a unique fence key, eg wof:id")
+	minLevel := flag.Int("minLevel", regionagogo.DefaultCovererSettings.MinLevel, "Minimum level of the covering cells")
+	maxLevel := flag.Int("maxLevel", regionagogo.DefaultCovererSettings.MaxLevel, "Maximum level of the covering cells")
+	levelMod := flag.Int("levelMod", regionagogo.DefaultCovererSettings.LevelMod, "Only use covering cells levels multiple of levelMod above minLevel, 1 to 3")
+	maxCells := flag.Int("maxCells", regionagogo.DefaultCovererSettings.MaxCells, "Maximum number of cells per covering")
+	coverReport := flag.Bool("coverReport", false, "Print the coverings sizes and levels of each fence to stdout")
+	batchSize := flag.Int("batchSize", 1000, "Number of fences stored per transaction")
 
 	flag.Parse()
 
-	if len(*filename) == 0 {
+	inputFormat, ok := formats[*format]
+	if !ok {
+		fmt.Println("Invalid format", *format)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if (*format == "shp" || *format == "kmz") && len(*filename) == 0 {
+		fmt.Println("A", *format, "file can't be read from stdin")
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
@@ -91,6 +120,18 @@ func main() {
 		}
 	}
 
+	coverer := regionagogo.CovererSettings{
+		MinLevel: *minLevel,
+		MaxLevel: *maxLevel,
+		LevelMod: *levelMod,
+		MaxCells: *maxCells,
+	}
+	if err := coverer.Validate(); err != nil {
+		fmt.Println(err)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
 	opts := boltdb.WithDebug(*debug)
 
 	gs, err := boltdb.NewGeoFenceBoltDB(*dbpath, opts)
@@ -98,17 +139,91 @@ func main() {
 		log.Fatal(err)
 	}
 
-	fi, err := os.Open(*filename)
-	defer fi.Close()
-	if err != nil {
-		log.Fatal(err)
+	fi := os.Stdin
+	source := "stdin"
+	if len(*filename) > 0 {
+		fi, err = os.Open(*filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fi.Close()
+		source = filepath.Base(*filename)
+	}
+	var r io.Reader = bufio.NewReader(fi)
+
+	// the progress is only known for regular files, not for pipes
+	var size int64
+	if st, err := fi.Stat(); err == nil && st.Mode().IsRegular() {
+		size = st.Size()
+	}
+
+	if *format == "kmz" {
+		// the placemarks are read from the KML document of the archive
+		zr, err := zip.NewReader(fi, size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		doc, err := regionagogo.KMZDocument(zr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rc, err := doc.Open()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rc.Close()
+		r = bufio.NewReader(rc)
+		size = int64(doc.UncompressedSize64)
+	}
+
+	var i *regionagogo.Import
+	switch inputFormat {
+	case regionagogo.FormatShapefile:
+		// the attributes are in the .dbf next to the .shp
+		dbf, err := os.Open(strings.TrimSuffix(*filename, filepath.Ext(*filename)) + ".dbf")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer dbf.Close()
+		i = regionagogo.NewShapefileImport(gs, r, bufio.NewReader(dbf), importFields.Fields, forceFieldsMap, renameFieldsMap)
+	case regionagogo.FormatKML:
+		i = regionagogo.NewKMLImport(gs, r, importFields.Fields, forceFieldsMap, renameFieldsMap)
+	case regionagogo.FormatCSV:
+		i = regionagogo.NewCSVImport(gs, r, *geometryColumn, importFields.Fields, forceFieldsMap, renameFieldsMap)
+	default:
+		i = regionagogo.NewGeoJSONImport(gs, r, importFields.Fields, forceFieldsMap, renameFieldsMap)
+		i.FeatureImport = *featureImport
+		i.Format = inputFormat
+	}
+	i.KeyField = *keyField
+	i.Coverer = coverer
+	i.BatchSize = *batchSize
+	i.Progress = func(fences int, bytesRead int64) {
+		if size > 0 {
+			log.Printf("%d fences imported, %.1f%% read", fences, float64(bytesRead)*100/float64(size))
+			return
+		}
+		log.Println(fences, "fences imported")
+	}
+	if *coverReport {
+		i.CoverReport = os.Stdout
 	}
-	r := bufio.NewReader(fi)
 
-	i := regionagogo.NewGeoJSONImport(gs, r, importFields.Fields, forceFieldsMap, renameFieldsMap)
-	i.FeatureImport = *featureImport
+	// the fences of a db are all covered the same way, the admin API covers new fences with these settings
+	if err := gs.SetCovererSettings(coverer); err != nil {
+		log.Fatal(err)
+	}
 	if err := i.Start(); err != nil {
 		log.Fatal(err)
 	}
 
+	if err := gs.RecordImport(source, importFields.Fields, *keyField); err != nil {
+		log.Fatal(err)
+	}
+
+	// a read only db opened later uses the persisted index instead of loading the tree
+	if err := gs.BuildIndex(); err != nil {
+		log.Fatal(err)
+	}
+
 }
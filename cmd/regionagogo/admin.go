@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/akhenakh/regionagogo"
+	"github.com/akhenakh/regionagogo/db/boltdb"
+	"github.com/akhenakh/regionagogo/geostore"
+	pb "github.com/akhenakh/regionagogo/regionagogosvc"
+	"github.com/kpawlik/geojson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// errInvalidGeoJSON is returned when an admin request body is not a usable GeoJSON
+var errInvalidGeoJSON = errors.New("expecting a GeoJSON Feature or a non empty FeatureCollection")
+
+// adminServer exposes the admin API, every call must carry the admin token
+type adminServer struct {
+	*server
+	token    string
+	fields   []string
+	keyField string
+	reloader *reloadableDB
+}
+
+// importer returns the pipeline preparing the admin fences, built from the current db
+// so the fences are covered like its import did, a reloaded db included
+func (a *adminServer) importer() (*regionagogo.Import, error) {
+	coverer, err := a.reloader.CovererSettings()
+	if err != nil {
+		return nil, err
+	}
+	i := regionagogo.NewGeoJSONImport(a.reloader, nil, a.fields, nil, nil)
+	i.KeyField = a.keyField
+	i.Coverer = coverer
+	return i, nil
+}
+
+// authorized returns true if the Authorization header value is a bearer of the admin token
+func (a *adminServer) authorized(header string) bool {
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// addFences stores the fences of a GeoJSON Feature or FeatureCollection
+// all features are validated then stored in one transaction, either all of them are stored or none
+func (a *adminServer) addFences(r io.Reader) (int, error) {
+	features, err := decodeFeatures(r)
+	if err != nil {
+		return 0, err
+	}
+
+	importer, err := a.importer()
+	if err != nil {
+		return 0, err
+	}
+
+	fss := make([]*geostore.FenceStorage, len(features))
+	fcs := make([]*geostore.FenceCover, len(features))
+	for i, f := range features {
+		fss[i], fcs[i], err = importer.PrepareFeature(f)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := a.reloader.StoreFences(fss, fcs); err != nil {
+		return 0, err
+	}
+
+	return len(fss), nil
+}
+
+// replaceFence replaces fence by the GeoJSON Feature read from r
+// the fence keeps its key unless the feature carries a new one
+func (a *adminServer) replaceFence(fence *regionagogo.Fence, r io.Reader) error {
+	features, err := decodeFeatures(r)
+	if err != nil {
+		return err
+	}
+	if len(features) != 1 {
+		return errInvalidGeoJSON
+	}
+
+	importer, err := a.importer()
+	if err != nil {
+		return err
+	}
+	fs, cover, err := importer.PrepareFeature(features[0])
+	if err != nil {
+		return err
+	}
+	if fs.Key == "" {
+		fs.Key = fence.Key
+	}
+
+	return a.UpdateFence(fence.ID, fs, cover)
+}
+
+// fenceByRef returns the fence referenced by its id or, when id is 0, by its key
+func (a *adminServer) fenceByRef(id uint64, key string) *regionagogo.Fence {
+	if id != 0 {
+		return a.FenceByID(id)
+	}
+	if key != "" {
+		return a.FenceByKey(key)
+	}
+	return nil
+}
+
+// decodeFeatures decodes a GeoJSON Feature or FeatureCollection
+func decodeFeatures(r io.Reader) ([]*geojson.Feature, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var object struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+
+	switch object.Type {
+	case "FeatureCollection":
+		var fc geojson.FeatureCollection
+		if err := json.Unmarshal(raw, &fc); err != nil {
+			return nil, err
+		}
+		if len(fc.Features) == 0 {
+			return nil, errInvalidGeoJSON
+		}
+		return fc.Features, nil
+	case "Feature":
+		var f geojson.Feature
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, err
+		}
+		return []*geojson.Feature{&f}, nil
+	default:
+		return nil, errInvalidGeoJSON
+	}
+}
+
+// adminHandler serves the admin HTTP API, POST /admin/fences with a GeoJSON Feature or FeatureCollection
+// body adds fences, PUT /admin/fences/{id} or /admin/fences/key/{key} with a GeoJSON Feature body
+// replaces a fence, DELETE on the same paths removes it
+func (a *adminServer) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r.Header.Get("Authorization")) {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/admin/fences")
+
+	var count int
+	var err error
+	switch {
+	case path == "" || path == "/":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", 405)
+			return
+		}
+		count, err = a.addFences(r.Body)
+	case r.Method == http.MethodPut || r.Method == http.MethodDelete:
+		var fence *regionagogo.Fence
+		if strings.HasPrefix(path, "/key/") {
+			fence = a.fenceByRef(0, strings.TrimPrefix(path, "/key/"))
+		} else {
+			id, perr := strconv.ParseUint(strings.TrimPrefix(path, "/"), 10, 64)
+			if perr != nil {
+				http.Error(w, "invalid id", 400)
+				return
+			}
+			fence = a.fenceByRef(id, "")
+		}
+		if fence == nil {
+			http.Error(w, "fence not found", 404)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			err = a.replaceFence(fence, r.Body)
+		} else {
+			err = a.DeleteFence(fence.ID)
+		}
+		if err == nil {
+			count = 1
+		}
+	default:
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), adminHTTPStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(map[string]int{"count": count})
+	w.Write(js)
+}
+
+// adminHTTPStatus returns the HTTP status code of an admin error
+func adminHTTPStatus(err error) int {
+	switch err {
+	case regionagogo.ErrFenceNotFound:
+		return 404
+	case regionagogo.ErrKeyExists:
+		return 409
+	case regionagogo.ErrInvalidFence, errInvalidGeoJSON, io.EOF, io.ErrUnexpectedEOF:
+		// an empty or truncated body
+		return 400
+	case boltdb.ErrReadOnly:
+		// the server is read only
+		return 403
+	}
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return 400
+	}
+	return 500
+}
+
+// authorize checks the admin token carried by the gRPC metadata
+func (a *adminServer) authorize(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing metadata")
+	}
+	for _, v := range md["authorization"] {
+		if a.authorized(v) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+// adminGRPCError converts an admin error to a gRPC status error
+func adminGRPCError(err error) error {
+	switch adminHTTPStatus(err) {
+	case 404:
+		return status.Error(codes.NotFound, err.Error())
+	case 409:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case 400:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case 403:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
+func (a *adminServer) AddFences(ctx context.Context, req *pb.AddFencesRequest) (*pb.AdminResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	count, err := a.addFences(strings.NewReader(req.Geojson))
+	if err != nil {
+		return nil, adminGRPCError(err)
+	}
+
+	return &pb.AdminResponse{Count: uint32(count)}, nil
+}
+
+func (a *adminServer) ReplaceFence(ctx context.Context, req *pb.ReplaceFenceRequest) (*pb.AdminResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	fence := a.fenceByRef(req.GetFence().GetId(), req.GetFence().GetKey())
+	if fence == nil {
+		return nil, status.Error(codes.NotFound, "fence not found")
+	}
+
+	if err := a.replaceFence(fence, strings.NewReader(req.Geojson)); err != nil {
+		return nil, adminGRPCError(err)
+	}
+
+	return &pb.AdminResponse{Count: 1}, nil
+}
+
+func (a *adminServer) RemoveFence(ctx context.Context, req *pb.FenceRef) (*pb.AdminResponse, error) {
+	if err := a.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	fence := a.fenceByRef(req.Id, req.Key)
+	if fence == nil {
+		return nil, status.Error(codes.NotFound, "fence not found")
+	}
+
+	if err := a.DeleteFence(fence.ID); err != nil {
+		return nil, adminGRPCError(err)
+	}
+
+	return &pb.AdminResponse{Count: 1}, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	pb "github.com/akhenakh/regionagogo/regionagogosvc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testToken = "secret"
+
+// keyedFeature is a GeoJSON Feature of a square around 0,0 with a key
+func keyedFeature(name, key string) string {
+	return fmt.Sprintf(`{"type":"Feature","properties":{"name":%q,"key":%q},"geometry":{"type":"Polygon","coordinates":[[[-1,-1],[1,-1],[1,1],[-1,1],[-1,-1]]]}}`, name, key)
+}
+
+// createAdmin returns an admin server over a db holding a fence named old, the fences are keyed by their key property
+func createAdmin(t testing.TB, readOnly bool) (*adminServer, func()) {
+	rdb, _, clean := createReloadableDB(t, "old", readOnly)
+	return &adminServer{server: &server{GeoFenceDB: rdb}, token: testToken, fields: []string{"name"}, keyField: "key", reloader: rdb}, clean
+}
+
+// adminRequest calls the admin HTTP API with the admin token
+func adminRequest(a *adminServer, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	if path == "/admin/reload" {
+		a.reloadHandler(w, req)
+	} else {
+		a.adminHandler(w, req)
+	}
+	return w
+}
+
+func TestAdminHTTPAuth(t *testing.T) {
+	a, clean := createAdmin(t, false)
+	defer clean()
+
+	for _, header := range []string{"", testToken, "Bearer ", "Bearer bad", "Basic " + testToken} {
+		for _, path := range []string{"/admin/fences", "/admin/reload"} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(keyedFeature("a", "a")))
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			w := httptest.NewRecorder()
+			if path == "/admin/reload" {
+				a.reloadHandler(w, req)
+			} else {
+				a.adminHandler(w, req)
+			}
+			require.Equal(t, 401, w.Code, header)
+		}
+	}
+	require.Nil(t, a.FenceByKey("a"))
+}
+
+func TestAdminHTTP(t *testing.T) {
+	a, clean := createAdmin(t, false)
+	defer clean()
+
+	collection := `{"type":"FeatureCollection","features":[` + keyedFeature("a", "a") + `,` + keyedFeature("b", "b") + `]}`
+	w := adminRequest(a, http.MethodPost, "/admin/fences", collection)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.JSONEq(t, `{"count":2}`, w.Body.String())
+	require.NotNil(t, a.FenceByKey("a"))
+	require.NotNil(t, a.FenceByKey("b"))
+
+	// a key already used, none of the fences is stored
+	collection = `{"type":"FeatureCollection","features":[` + keyedFeature("c", "c") + `,` + keyedFeature("a", "a") + `]}`
+	w = adminRequest(a, http.MethodPost, "/admin/fences", collection)
+	require.Equal(t, 409, w.Code)
+	require.Nil(t, a.FenceByKey("c"))
+
+	// the same key twice in a collection
+	collection = `{"type":"FeatureCollection","features":[` + keyedFeature("c", "c") + `,` + keyedFeature("c", "c") + `]}`
+	w = adminRequest(a, http.MethodPost, "/admin/fences", collection)
+	require.Equal(t, 409, w.Code)
+	require.Nil(t, a.FenceByKey("c"))
+
+	for _, body := range []string{
+		`{"type":`,
+		`{"type":"Point","coordinates":[0,0]}`,
+		`{"type":"FeatureCollection","features":[]}`,
+		`{"type":"Feature","properties":{"key":"d"},"geometry":{"type":"Point","coordinates":[0,0]}}`,
+	} {
+		w = adminRequest(a, http.MethodPost, "/admin/fences", body)
+		require.Equal(t, 400, w.Code, body)
+	}
+	w = adminRequest(a, http.MethodGet, "/admin/fences", "")
+	require.Equal(t, 405, w.Code)
+
+	// replace by id and by key
+	id := a.FenceByKey("a").ID
+	w = adminRequest(a, http.MethodPut, "/admin/fences/"+strconv.FormatUint(id, 10), keyedFeature("a2", "a"))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.Equal(t, "a2", a.FenceByKey("a").Data["name"])
+
+	w = adminRequest(a, http.MethodPut, "/admin/fences/key/b", keyedFeature("b2", "b"))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.Equal(t, "b2", a.FenceByKey("b").Data["name"])
+
+	// a replacement can't take the key of another fence
+	w = adminRequest(a, http.MethodPut, "/admin/fences/key/b", keyedFeature("b3", "a"))
+	require.Equal(t, 409, w.Code)
+	require.Equal(t, "b2", a.FenceByKey("b").Data["name"])
+
+	w = adminRequest(a, http.MethodPut, "/admin/fences/key/unknown", keyedFeature("x", "x"))
+	require.Equal(t, 404, w.Code)
+	w = adminRequest(a, http.MethodPut, "/admin/fences/notanid", keyedFeature("x", "x"))
+	require.Equal(t, 400, w.Code)
+	w = adminRequest(a, http.MethodPut, "/admin/fences/key/a", `{"type":"Feature"`)
+	require.Equal(t, 400, w.Code)
+
+	// remove by id and by key
+	id = a.FenceByKey("a").ID
+	w = adminRequest(a, http.MethodDelete, "/admin/fences/"+strconv.FormatUint(id, 10), "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.JSONEq(t, `{"count":1}`, w.Body.String())
+	require.Nil(t, a.FenceByID(id))
+	require.Nil(t, a.FenceByKey("a"))
+
+	w = adminRequest(a, http.MethodDelete, "/admin/fences/key/b", "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.Nil(t, a.FenceByKey("b"))
+
+	w = adminRequest(a, http.MethodDelete, "/admin/fences/key/b", "")
+	require.Equal(t, 404, w.Code)
+	w = adminRequest(a, http.MethodDelete, "/admin/fences/"+strconv.FormatUint(id, 10), "")
+	require.Equal(t, 404, w.Code)
+
+	// the served file has not been replaced
+	w = adminRequest(a, http.MethodPost, "/admin/reload", "")
+	require.Equal(t, 409, w.Code)
+	w = adminRequest(a, http.MethodGet, "/admin/reload", "")
+	require.Equal(t, 405, w.Code)
+}
+
+func TestAdminHTTPReadOnly(t *testing.T) {
+	a, clean := createAdmin(t, true)
+	defer clean()
+
+	w := adminRequest(a, http.MethodPost, "/admin/fences", keyedFeature("a", "a"))
+	require.Equal(t, 403, w.Code)
+
+	fences, err := a.StubbingQuery(0, 0)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	w = adminRequest(a, http.MethodDelete, "/admin/fences/"+strconv.FormatUint(fences[0].ID, 10), "")
+	require.Equal(t, 403, w.Code)
+	require.NotNil(t, a.FenceByID(fences[0].ID))
+}
+
+// startAdminGRPC serves the admin gRPC API on a local port
+func startAdminGRPC(t testing.TB, a *adminServer) (pb.RegionAGogoAdminClient, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	pb.RegisterRegionAGogoAdminServer(s, a)
+	go s.Serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	return pb.NewRegionAGogoAdminClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestAdminGRPC(t *testing.T) {
+	a, clean := createAdmin(t, false)
+	defer clean()
+	c, stop := startAdminGRPC(t, a)
+	defer stop()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken)
+
+	// missing and bad tokens
+	for _, actx := range []context.Context{
+		context.Background(),
+		metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer bad"),
+		metadata.AppendToOutgoingContext(context.Background(), "authorization", testToken),
+	} {
+		_, err := c.AddFences(actx, &pb.AddFencesRequest{Geojson: keyedFeature("a", "a")})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		_, err = c.RemoveFence(actx, &pb.FenceRef{Key: "a"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	require.Nil(t, a.FenceByKey("a"))
+
+	collection := `{"type":"FeatureCollection","features":[` + keyedFeature("a", "a") + `,` + keyedFeature("b", "b") + `]}`
+	resp, err := c.AddFences(ctx, &pb.AddFencesRequest{Geojson: collection})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), resp.Count)
+
+	_, err = c.AddFences(ctx, &pb.AddFencesRequest{Geojson: keyedFeature("a", "a")})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = c.AddFences(ctx, &pb.AddFencesRequest{Geojson: `{"type":"Point","coordinates":[0,0]}`})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// replace by id and by key
+	id := a.FenceByKey("a").ID
+	resp, err = c.ReplaceFence(ctx, &pb.ReplaceFenceRequest{Fence: &pb.FenceRef{Id: id}, Geojson: keyedFeature("a2", "a")})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), resp.Count)
+	require.Equal(t, "a2", a.FenceByKey("a").Data["name"])
+
+	_, err = c.ReplaceFence(ctx, &pb.ReplaceFenceRequest{Fence: &pb.FenceRef{Key: "b"}, Geojson: keyedFeature("b2", "b")})
+	require.NoError(t, err)
+	require.Equal(t, "b2", a.FenceByKey("b").Data["name"])
+
+	_, err = c.ReplaceFence(ctx, &pb.ReplaceFenceRequest{Fence: &pb.FenceRef{Key: "unknown"}, Geojson: keyedFeature("x", "x")})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.ReplaceFence(ctx, &pb.ReplaceFenceRequest{Fence: &pb.FenceRef{Key: "b"}, Geojson: `{"type":`})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// remove by id and by key
+	resp, err = c.RemoveFence(ctx, &pb.FenceRef{Id: id})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), resp.Count)
+	require.Nil(t, a.FenceByKey("a"))
+
+	_, err = c.RemoveFence(ctx, &pb.FenceRef{Key: "b"})
+	require.NoError(t, err)
+	require.Nil(t, a.FenceByKey("b"))
+
+	_, err = c.RemoveFence(ctx, &pb.FenceRef{Key: "b"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAdminGRPCReadOnly(t *testing.T) {
+	a, clean := createAdmin(t, true)
+	defer clean()
+	c, stop := startAdminGRPC(t, a)
+	defer stop()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testToken)
+	_, err := c.AddFences(ctx, &pb.AddFencesRequest{Geojson: keyedFeature("a", "a")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -1,21 +1,43 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/akhenakh/regionagogo"
 	"github.com/akhenakh/regionagogo/db/boltdb"
 	pb "github.com/akhenakh/regionagogo/regionagogosvc"
+	"github.com/golang/geo/s2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+const (
+	// maxBatchPoints is the maximum number of positions of a batch query
+	maxBatchPoints = 100000
+
+	// maxBatchBodySize is the maximum size in bytes of a POST /query/batch body
+	maxBatchBodySize = 8 << 20
+)
+
+// errTooManyPoints is returned when a batch query has more than maxBatchPoints positions
+var errTooManyPoints = fmt.Errorf("too many positions, the maximum is %d", maxBatchPoints)
+
 type server struct {
 	regionagogo.GeoFenceDB
 }
@@ -25,54 +47,490 @@ func (s *server) GetRegion(ctx context.Context, p *pb.Point) (*pb.RegionResponse
 	if err != nil {
 		return nil, err
 	}
+
+	return regionResponse(region), nil
+}
+
+func (s *server) GetFences(ctx context.Context, req *pb.FencesRequest) (*pb.FencesResponse, error) {
+	fences, err := s.StubbingQuery(float64(req.Latitude), float64(req.Longitude),
+		regionagogo.WithMultipleFences(req.MultipleFences))
+	if err != nil {
+		return nil, err
+	}
+
+	return fencesToPB(fences, req.Geometry), nil
+}
+
+func (s *server) GetRegions(ctx context.Context, req *pb.Points) (*pb.RegionsResponse, error) {
+	if len(req.Points) > maxBatchPoints {
+		return nil, status.Error(codes.InvalidArgument, errTooManyPoints.Error())
+	}
+
+	points := make([]regionagogo.LatLng, len(req.Points))
+	for i, p := range req.Points {
+		points[i] = regionagogo.LatLng{Lat: float64(p.Latitude), Lng: float64(p.Longitude)}
+	}
+
+	regions, err := s.BatchStubbingQuery(points)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.RegionsResponse{Regions: make([]*pb.RegionResponse, len(regions))}
+	for i, region := range regions {
+		res.Regions[i] = regionResponse(region)
+	}
+
+	return res, nil
+}
+
+// StreamRegions answers each received point in order, until the client closes the stream
+func (s *server) StreamRegions(stream pb.RegionAGogo_StreamRegionsServer) error {
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		region, err := s.StubbingQuery(float64(p.Latitude), float64(p.Longitude))
+		if err != nil {
+			return err
+		}
+
+		res := regionResponse(region)
+		res.Id = p.Id
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// regionResponse returns the gRPC response for the fences matching a point
+func regionResponse(region regionagogo.Fences) *pb.RegionResponse {
 	if region == nil || len(region) == 0 {
-		return &pb.RegionResponse{Code: "unknown"}, nil
+		return &pb.RegionResponse{Code: "unknown"}
 	}
 
 	// default is to lookup for "iso"
 	iso, ok := region[0].Data["iso"]
 	if !ok {
-		return &pb.RegionResponse{Code: "unknown"}, nil
+		return &pb.RegionResponse{Code: "unknown"}
+	}
+
+	return &pb.RegionResponse{Code: iso}
+}
+
+func (s *server) GetFenceByKey(ctx context.Context, req *pb.FenceKeyRequest) (*pb.Fence, error) {
+	fence := s.FenceByKey(req.Key)
+	if fence == nil {
+		return nil, status.Error(codes.NotFound, "fence not found")
+	}
+
+	return fenceToPB(fence, req.Geometry), nil
+}
+
+func (s *server) GetNearestFences(ctx context.Context, req *pb.NearestRequest) (*pb.FencesResponse, error) {
+	if req.K < 1 {
+		return nil, status.Error(codes.InvalidArgument, "invalid k, at least 1 fence")
+	}
+
+	fences, err := s.NearestQuery(float64(req.Latitude), float64(req.Longitude), int(req.K), req.MaxDistance)
+	if err != nil {
+		return nil, err
+	}
+
+	return fencesToPB(fences, false), nil
+}
+
+func (s *server) GetFenceByID(ctx context.Context, req *pb.FenceIDRequest) (*pb.Fence, error) {
+	fence := s.FenceByID(req.Id)
+	if fence == nil {
+		return nil, status.Error(codes.NotFound, "fence not found")
+	}
+
+	return fenceToPB(fence, req.Geometry), nil
+}
+
+func (s *server) GetFencesInRect(ctx context.Context, req *pb.RectRequest) (*pb.FencesResponse, error) {
+	ur, bl := req.UpperRight, req.BottomLeft
+	if ur == nil || bl == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing rect corner")
+	}
+
+	// pb relations have the same values as regionagogo relations
+	fences, err := s.RectQuery(float64(ur.Latitude), float64(ur.Longitude), float64(bl.Latitude), float64(bl.Longitude),
+		regionagogo.WithRelation(regionagogo.Relation(req.Relation)))
+	if err == regionagogo.ErrUnsupportedRelation {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fencesToPB(fences, req.Geometry), nil
+}
+
+func (s *server) GetFencesInRadius(ctx context.Context, req *pb.RadiusRequest) (*pb.FencesResponse, error) {
+	fences, err := s.RadiusQuery(float64(req.Latitude), float64(req.Longitude), req.Radius,
+		regionagogo.WithRelation(regionagogo.Relation(req.Relation)))
+	if err == regionagogo.ErrUnsupportedRelation {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	rs := pb.RegionResponse{Code: iso}
-	return &rs, nil
+	return fencesToPB(fences, req.Geometry), nil
+}
+
+// fencesToPB converts fences to their gRPC response
+func fencesToPB(fences regionagogo.Fences, geometry bool) *pb.FencesResponse {
+	res := &pb.FencesResponse{Fences: make([]*pb.Fence, len(fences))}
+	for i, fence := range fences {
+		res.Fences[i] = fenceToPB(fence, geometry)
+	}
+
+	return res
+}
+
+// fenceToPB converts a fence to its gRPC message, with its loops if geometry is true
+func fenceToPB(fence *regionagogo.Fence, geometry bool) *pb.Fence {
+	f := &pb.Fence{Id: fence.ID, Key: fence.Key, Data: fence.Data, Distance: fence.Distance}
+	if !geometry {
+		return f
+	}
+
+	for _, l := range fence.Polygon.Loops() {
+		vertices := l.Vertices()
+		loop := &pb.Loop{Points: make([]*pb.Point, len(vertices)), Hole: l.IsHole()}
+		for i, v := range vertices {
+			ll := s2.LatLngFromPoint(v)
+			loop.Points[i] = &pb.Point{Latitude: float32(ll.Lat.Degrees()), Longitude: float32(ll.Lng.Degrees())}
+		}
+		f.Loops = append(f.Loops, loop)
+	}
+
+	return f
 }
 
 // queryHandler takes a lat & lng query params and return a JSON
 // with the country of the coordinate
 func (s *server) queryHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	slat := query.Get("lat")
-	lat, err := strconv.ParseFloat(slat, 64)
+	lat, lng, err := parseLatLng(r.URL.Query())
 	if err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
-	slng := query.Get("lng")
-	lng, err := strconv.ParseFloat(slng, 64)
+
+	fences, err := s.StubbingQuery(lat, lng)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(queryResult(fences))
+	w.Write(js)
+}
+
+// batchHandler takes a JSON array or NDJSON of {"lat": 48.8, "lng": 2.2} positions in a POST body
+// and returns a JSON array with the result of a query for each position, in the same order
+// the body is limited to maxBatchBodySize bytes and maxBatchPoints positions
+func (s *server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	points, err := decodeLatLngs(http.MaxBytesReader(w, r.Body, maxBatchBodySize), maxBatchPoints)
+	if err == errTooManyPoints {
+		http.Error(w, err.Error(), 413)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 400)
 		return
 	}
 
-	fences, err := s.StubbingQuery(lat, lng)
+	regions, err := s.BatchStubbingQuery(points)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
+
+	res := make([]map[string]string, len(regions))
+	for i, fences := range regions {
+		res[i] = queryResult(fences)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(res)
+	w.Write(js)
+}
+
+// decodeLatLngs decodes positions from a JSON array or a stream of JSON objects (NDJSON)
+// errTooManyPoints is returned as soon as more than max positions are read
+func decodeLatLngs(r io.Reader, max int) ([]regionagogo.LatLng, error) {
+	br := bufio.NewReader(r)
 
+	// look at the first non space byte to detect an array
+	var array bool
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil, errors.New("empty body")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		br.UnreadByte()
+		array = b == '['
+		break
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		// the array elements are decoded one at a time to stop at max
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	var points []regionagogo.LatLng
+	for {
+		if array && !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return points, nil
+		}
+
+		var p regionagogo.LatLng
+		err := dec.Decode(&p)
+		if err == io.EOF && !array {
+			return points, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(points) == max {
+			return nil, errTooManyPoints
+		}
+		points = append(points, p)
+	}
+}
+
+// queryResult returns the data of the first fence, the response of a query
+func queryResult(fences regionagogo.Fences) map[string]string {
 	if len(fences) < 1 {
-		js, _ := json.Marshal(map[string]string{"name": "unknown"})
-		w.Write(js)
+		return map[string]string{"name": "unknown"}
+	}
+
+	return fences[0].Data
+}
+
+// nearestHandler takes lat & lng, k and max (meters) query params and returns
+// a JSON array of the k nearest fences with their distance
+func (s *server) nearestHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, lng, err := parseLatLng(query)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	k := 1
+	if sk := query.Get("k"); sk != "" {
+		k, err = strconv.Atoi(sk)
+		if err != nil || k < 1 {
+			http.Error(w, "invalid k", 400)
+			return
+		}
+	}
+
+	var maxDistance float64
+	if smax := query.Get("max"); smax != "" {
+		maxDistance, err = strconv.ParseFloat(smax, 64)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+
+	fences, err := s.NearestQuery(lat, lng, k, maxDistance)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if fences == nil {
+		fences = regionagogo.Fences{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(fences)
+	w.Write(js)
+}
+
+// fenceByKeyHandler returns a GeoJSON of the fence matching the key in /fences/key/{key}, like /fences/{id}
+func (s *server) fenceByKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/fences/key/")
+	if key == "" {
+		http.Error(w, "missing key", 400)
+		return
+	}
+
+	fence := s.FenceByKey(key)
+	if fence == nil {
+		http.Error(w, "fence not found", 404)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(fence.ToGeoJSON())
+	w.Write(js)
+}
+
+// fenceByIDHandler returns a GeoJSON of the fence matching the id in /fences/{id}
+func (s *server) fenceByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/fences/"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", 400)
+		return
+	}
+
+	fence := s.FenceByID(id)
+	if fence == nil {
+		http.Error(w, "fence not found", 404)
 		return
 	}
 
-	js, _ := json.Marshal(fences[0].Data)
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(fence.ToGeoJSON())
 	w.Write(js)
 }
 
+// metadataDB is a db exposing its metadata
+type metadataDB interface {
+	Metadata() (*boltdb.Metadata, error)
+}
+
+// infoHandler returns the db metadata as JSON
+func (s *server) infoHandler(w http.ResponseWriter, r *http.Request) {
+	mdb, ok := s.GeoFenceDB.(metadataDB)
+	if !ok {
+		http.Error(w, "no metadata", 404)
+		return
+	}
+
+	m, err := mdb.Metadata()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(m)
+	w.Write(js)
+}
+
+// rectHandler takes urlat & urlng upper right, bllat & bllng bottom left and relation query params
+// and returns a GeoJSON of the fences
+func (s *server) rectHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var corners [4]float64
+	for i, k := range []string{"urlat", "urlng", "bllat", "bllng"} {
+		v, err := strconv.ParseFloat(query.Get(k), 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s", k), 400)
+			return
+		}
+		corners[i] = v
+	}
+
+	relation, err := parseRelation(query.Get("relation"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	fences, err := s.RectQuery(corners[0], corners[1], corners[2], corners[3], regionagogo.WithRelation(relation))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(fences.ToGeoJSON())
+	w.Write(js)
+}
+
+// radiusHandler takes lat & lng, radius (meters) and relation query params
+// and returns a GeoJSON of the fences
+func (s *server) radiusHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	lat, lng, err := parseLatLng(query)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	radius, err := strconv.ParseFloat(query.Get("radius"), 64)
+	if err != nil || radius <= 0 {
+		http.Error(w, "invalid radius", 400)
+		return
+	}
+
+	relation, err := parseRelation(query.Get("relation"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	fences, err := s.RadiusQuery(lat, lng, radius, regionagogo.WithRelation(relation))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	js, _ := json.Marshal(fences.ToGeoJSON())
+	w.Write(js)
+}
+
+// parseRelation returns the relation named by the relation query param, approximate by default
+func parseRelation(name string) (regionagogo.Relation, error) {
+	switch name {
+	case "", "approximate":
+		return regionagogo.Approximate, nil
+	case "intersects":
+		return regionagogo.Intersects, nil
+	case "within":
+		return regionagogo.Within, nil
+	case "contains":
+		return regionagogo.Contains, nil
+	}
+	return 0, fmt.Errorf("invalid relation %q", name)
+}
+
+// parseLatLng returns the lat & lng query params
+func parseLatLng(query url.Values) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	lng, err := strconv.ParseFloat(query.Get("lng"), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lat, lng, nil
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -81,19 +539,61 @@ func main() {
 	httpPort := flag.Int("httpPort", 8082, "http debug port to listen on")
 	grpcPort := flag.Int("grpcPort", 8083, "grpc port to listen on")
 	cachedEntries := flag.Uint("cachedEntries", 0, "Region Cache size, 0 for disabled")
+	adminToken := flag.String("adminToken", "", "Bearer token of the admin API, empty to disable it")
+	importFields := flag.String("importFields", "", "Comma separated GeoJSON properties stored with fences added by the admin API")
+	keyField := flag.String("keyField", "", "GeoJSON property used as a unique fence key by the admin API")
+	watchInterval := flag.Duration("watchInterval", 0, "Interval between checks of the db file, reloaded when replaced, 0 to disable")
+	rangeIndex := flag.Bool("rangeIndex", false, "Use the sorted cell range index, faster lookups but slower admin writes")
+	readOnly := flag.Bool("readOnly", false, "Open the db read only, disables admin writes")
 
 	flag.Parse()
 	opts := []boltdb.GeoFenceBoltDBOption{
 		boltdb.WithCachedEntries(*cachedEntries),
 		boltdb.WithDebug(*debug),
+		boltdb.WithRangeIndex(*rangeIndex),
 	}
-	gs, err := boltdb.NewGeoFenceBoltDB(*dbpath, opts...)
+
+	// the db is reloaded on SIGHUP, on admin request or when watched once its file is replaced,
+	// the new file is always opened read only
+	rdb, err := openReloadableDB(*dbpath, *readOnly, opts)
 	if err != nil {
 		log.Fatal(err)
 	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := rdb.Reload(); err != nil {
+				log.Println("reload failed", err)
+			}
+		}
+	}()
+	if *watchInterval > 0 {
+		go rdb.watch(*watchInterval)
+	}
 
-	s := &server{GeoFenceDB: gs}
+	s := &server{GeoFenceDB: rdb}
 	http.HandleFunc("/query", s.queryHandler)
+	http.HandleFunc("/query/nearest", s.nearestHandler)
+	http.HandleFunc("/query/batch", s.batchHandler)
+	http.HandleFunc("/query/rect", s.rectHandler)
+	http.HandleFunc("/query/radius", s.radiusHandler)
+	http.HandleFunc("/fences/", s.fenceByIDHandler)
+	http.HandleFunc("/fences/key/", s.fenceByKeyHandler)
+	http.HandleFunc("/info", s.infoHandler)
+
+	var admin *adminServer
+	if *adminToken != "" {
+		var fields []string
+		if *importFields != "" {
+			fields = strings.Split(*importFields, ",")
+		}
+		admin = &adminServer{server: s, token: *adminToken, fields: fields, keyField: *keyField, reloader: rdb}
+		http.HandleFunc("/admin/fences", admin.adminHandler)
+		http.HandleFunc("/admin/fences/", admin.adminHandler)
+		http.HandleFunc("/admin/reload", admin.reloadHandler)
+	}
+
 	go func() {
 		log.Println(http.ListenAndServe(fmt.Sprintf(":%d", *httpPort), nil))
 	}()
@@ -106,5 +606,8 @@ func main() {
 
 	grpcServer := grpc.NewServer()
 	pb.RegisterRegionAGogoServer(grpcServer, s)
+	if admin != nil {
+		pb.RegisterRegionAGogoAdminServer(grpcServer, admin)
+	}
 	grpcServer.Serve(lis)
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	pb "github.com/akhenakh/regionagogo/regionagogosvc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFenceHandlers(t *testing.T) {
+	a, clean := createAdmin(t, false)
+	defer clean()
+
+	_, err := a.addFences(strings.NewReader(keyedFeature("a", "a")))
+	require.NoError(t, err)
+	fence := a.FenceByKey("a")
+	require.NotNil(t, fence)
+
+	byID := httptest.NewRecorder()
+	a.fenceByIDHandler(byID, httptest.NewRequest(http.MethodGet, "/fences/"+strconv.FormatUint(fence.ID, 10), nil))
+	require.Equal(t, 200, byID.Code)
+
+	// a fence by key is the same GeoJSON as by id
+	byKey := httptest.NewRecorder()
+	a.fenceByKeyHandler(byKey, httptest.NewRequest(http.MethodGet, "/fences/key/a", nil))
+	require.Equal(t, 200, byKey.Code)
+	require.JSONEq(t, byID.Body.String(), byKey.Body.String())
+	require.Contains(t, byKey.Body.String(), `"type":"FeatureCollection"`)
+
+	w := httptest.NewRecorder()
+	a.fenceByKeyHandler(w, httptest.NewRequest(http.MethodGet, "/fences/key/unknown", nil))
+	require.Equal(t, 404, w.Code)
+	w = httptest.NewRecorder()
+	a.fenceByIDHandler(w, httptest.NewRequest(http.MethodGet, "/fences/12345", nil))
+	require.Equal(t, 404, w.Code)
+
+	// the loops are only returned on request over gRPC
+	pbFence, err := a.GetFenceByKey(context.Background(), &pb.FenceKeyRequest{Key: "a"})
+	require.NoError(t, err)
+	require.Equal(t, fence.ID, pbFence.Id)
+	require.Empty(t, pbFence.Loops)
+	pbFence, err = a.GetFenceByKey(context.Background(), &pb.FenceKeyRequest{Key: "a", Geometry: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, pbFence.Loops)
+	_, err = a.GetFenceByKey(context.Background(), &pb.FenceKeyRequest{Key: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestNearestHandler(t *testing.T) {
+	a, clean := createAdmin(t, false)
+	defer clean()
+
+	w := httptest.NewRecorder()
+	a.nearestHandler(w, httptest.NewRequest(http.MethodGet, "/query/nearest?lat=0&lng=0", nil))
+	require.Equal(t, 200, w.Code)
+
+	// a position inside the fence is at distance 0, omitted
+	var fences []map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fences))
+	require.Len(t, fences, 1)
+	require.NotContains(t, fences[0], "distance")
+
+	w = httptest.NewRecorder()
+	a.nearestHandler(w, httptest.NewRequest(http.MethodGet, "/query/nearest?lat=0&lng=2", nil))
+	require.Equal(t, 200, w.Code)
+	fences = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fences))
+	require.Len(t, fences, 1)
+	require.InDelta(t, 111000, fences[0]["distance"], 1000)
+
+	w = httptest.NewRecorder()
+	a.nearestHandler(w, httptest.NewRequest(http.MethodGet, "/query/nearest?lat=0&lng=2&k=0", nil))
+	require.Equal(t, 400, w.Code)
+
+	// k has no default over gRPC
+	_, err := a.GetNearestFences(context.Background(), &pb.NearestRequest{Latitude: 0, Longitude: 2})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	resp, err := a.GetNearestFences(context.Background(), &pb.NearestRequest{Latitude: 0, Longitude: 2, K: 1})
+	require.NoError(t, err)
+	require.Len(t, resp.Fences, 1)
+}
+
+func TestBatchHandler(t *testing.T) {
+	a, clean := createAdmin(t, false)
+	defer clean()
+
+	for _, body := range []string{
+		`[{"lat":0,"lng":0},{"lat":10,"lng":10}]`,
+		"{\"lat\":0,\"lng\":0}\n{\"lat\":10,\"lng\":10}\n",
+	} {
+		w := httptest.NewRecorder()
+		a.batchHandler(w, httptest.NewRequest(http.MethodPost, "/query/batch", strings.NewReader(body)))
+		require.Equal(t, 200, w.Code, body)
+		require.JSONEq(t, `[{"name":"old"},{"name":"unknown"}]`, w.Body.String())
+	}
+
+	for _, body := range []string{"", "[", `[{"lat":0,"lng":0}`, `{"lat":`} {
+		w := httptest.NewRecorder()
+		a.batchHandler(w, httptest.NewRequest(http.MethodPost, "/query/batch", strings.NewReader(body)))
+		require.Equal(t, 400, w.Code, body)
+	}
+
+	// the positions are counted while decoding
+	for _, body := range []string{
+		`[{"lat":0,"lng":0},{"lat":1,"lng":1},{"lat":2,"lng":2}]`,
+		"{\"lat\":0,\"lng\":0}\n{\"lat\":1,\"lng\":1}\n{\"lat\":2,\"lng\":2}",
+	} {
+		points, err := decodeLatLngs(strings.NewReader(body), 3)
+		require.NoError(t, err)
+		require.Len(t, points, 3)
+		_, err = decodeLatLngs(strings.NewReader(body), 2)
+		require.Equal(t, errTooManyPoints, err)
+	}
+
+	body := "[" + strings.Repeat(`{"lat":0,"lng":0},`, maxBatchPoints) + `{"lat":0,"lng":0}]`
+	w := httptest.NewRecorder()
+	a.batchHandler(w, httptest.NewRequest(http.MethodPost, "/query/batch", strings.NewReader(body)))
+	require.Equal(t, 413, w.Code)
+
+	// the body size is limited
+	body = "[" + strings.Repeat(" ", maxBatchBodySize) + `{"lat":0,"lng":0}]`
+	w = httptest.NewRecorder()
+	a.batchHandler(w, httptest.NewRequest(http.MethodPost, "/query/batch", strings.NewReader(body)))
+	require.Equal(t, 400, w.Code)
+}
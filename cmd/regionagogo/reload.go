@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akhenakh/regionagogo"
+	"github.com/akhenakh/regionagogo/db/boltdb"
+	"github.com/akhenakh/regionagogo/geostore"
+)
+
+// how long a reload waits for the lock of the new db file
+const reloadOpenTimeout = 5 * time.Second
+
+// errNotReplaced is returned by Reload when dbpath is still the file being served
+var errNotReplaced = errors.New("db file not replaced, nothing to reload")
+
+// dbRef is a db, the file it was opened from and its in flight calls
+type dbRef struct {
+	regionagogo.GeoFenceDB
+	fi       os.FileInfo
+	inflight sync.WaitGroup
+}
+
+// reloadableDB is a GeoFenceDB whose underlying db can be swapped while serving
+// calls in flight keep using the db they started with, the old db is closed once they are done
+type reloadableDB struct {
+	// mu protects cur, a ref is acquired with the read lock held so none is acquired after a swap
+	mu  sync.RWMutex
+	cur *dbRef
+
+	// reloading serializes the reloads, cur is only replaced with it held
+	reloading sync.Mutex
+	dbpath    string
+	opts      []boltdb.GeoFenceBoltDBOption
+}
+
+// openReloadableDB opens the db at dbpath, read only or writable, a reloaded db is always opened read only
+func openReloadableDB(dbpath string, readOnly bool, opts []boltdb.GeoFenceBoltDBOption) (*reloadableDB, error) {
+	db, err := boltdb.NewGeoFenceBoltDB(dbpath, append(opts, boltdb.WithReadOnly(readOnly))...)
+	if err != nil {
+		return nil, err
+	}
+
+	// stated once opened, a writable db creates a missing file
+	fi, err := os.Stat(dbpath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &reloadableDB{cur: &dbRef{GeoFenceDB: db, fi: fi}, dbpath: dbpath, opts: opts}, nil
+}
+
+// acquire returns the current db, release it with inflight.Done once the call is over
+func (r *reloadableDB) acquire() *dbRef {
+	r.mu.RLock()
+	ref := r.cur
+	ref.inflight.Add(1)
+	r.mu.RUnlock()
+	return ref
+}
+
+// Reload opens the file at dbpath and builds its index, then swaps it with the current db
+// queries are served by the current db until the new one is ready.
+// A new db is deployed by renaming it over dbpath, the file being served is never reopened:
+// it is locked by the current db and its changes in place are the admin API writes,
+// Reload returns errNotReplaced for it.
+// The new db is opened read only: its file is a deployed build, writes to it would be lost
+// on the next deployment, the admin writes are refused once reloaded.
+func (r *reloadableDB) Reload() error {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	// stated before opening, a file replaced meanwhile is seen as new on the next reload
+	fi, err := os.Stat(r.dbpath)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(fi, r.cur.fi) {
+		return errNotReplaced
+	}
+
+	start := time.Now()
+	opts := append([]boltdb.GeoFenceBoltDBOption{}, r.opts...)
+	opts = append(opts, boltdb.WithReadOnly(true), boltdb.WithOpenTimeout(reloadOpenTimeout))
+	db, err := boltdb.NewGeoFenceBoltDB(r.dbpath, opts...)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	old := r.cur
+	r.cur = &dbRef{GeoFenceDB: db, fi: fi}
+	r.mu.Unlock()
+
+	// drain the calls started on the old db, writes in flight land in the replaced file
+	old.inflight.Wait()
+	log.Println("reloaded", r.dbpath, "in", time.Since(start))
+
+	return old.Close()
+}
+
+// watch reloads the db every time the file at dbpath is replaced, checking every interval
+// a failed reload is retried on the next check
+func (r *reloadableDB) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := r.Reload()
+		// the file may be in the middle of a replacement
+		if err == nil || err == errNotReplaced || os.IsNotExist(err) {
+			continue
+		}
+		log.Println("reload failed", err)
+	}
+}
+
+// reloadHandler reloads the db on POST /admin/reload
+func (a *adminServer) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r.Header.Get("Authorization")) {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", 405)
+		return
+	}
+
+	if err := a.reloader.Reload(); err != nil {
+		code := 500
+		if err == errNotReplaced {
+			code = 409
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *reloadableDB) FenceByID(loopID uint64) *regionagogo.Fence {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.FenceByID(loopID)
+}
+
+func (r *reloadableDB) FenceByKey(key string) *regionagogo.Fence {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.FenceByKey(key)
+}
+
+func (r *reloadableDB) StubbingQuery(lat, lng float64, opts ...regionagogo.QueryOptionsFunc) (regionagogo.Fences, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.StubbingQuery(lat, lng, opts...)
+}
+
+func (r *reloadableDB) BatchStubbingQuery(points []regionagogo.LatLng, opts ...regionagogo.QueryOptionsFunc) ([]regionagogo.Fences, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.BatchStubbingQuery(points, opts...)
+}
+
+func (r *reloadableDB) RectQuery(urlat, urlng, bllat, bllng float64, opts ...regionagogo.QueryOptionsFunc) (regionagogo.Fences, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.RectQuery(urlat, urlng, bllat, bllng, opts...)
+}
+
+func (r *reloadableDB) RadiusQuery(lat, lng, radius float64, opts ...regionagogo.QueryOptionsFunc) (regionagogo.Fences, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.RadiusQuery(lat, lng, radius, opts...)
+}
+
+func (r *reloadableDB) NearestQuery(lat, lng float64, k int, maxDistance float64) (regionagogo.Fences, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.NearestQuery(lat, lng, k, maxDistance)
+}
+
+func (r *reloadableDB) StoreFence(fs *geostore.FenceStorage, cover *geostore.FenceCover) error {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.StoreFence(fs, cover)
+}
+
+// fencesStorer is a db storing several fences in one transaction
+type fencesStorer interface {
+	StoreFences(fss []*geostore.FenceStorage, fcs []*geostore.FenceCover) error
+}
+
+// StoreFences stores the fences in one transaction of the current db
+func (r *reloadableDB) StoreFences(fss []*geostore.FenceStorage, fcs []*geostore.FenceCover) error {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	fdb, ok := ref.GeoFenceDB.(fencesStorer)
+	if !ok {
+		return errors.New("db can't store fences in one transaction")
+	}
+	return fdb.StoreFences(fss, fcs)
+}
+
+func (r *reloadableDB) DeleteFence(loopID uint64) error {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.DeleteFence(loopID)
+}
+
+func (r *reloadableDB) UpdateFence(loopID uint64, fs *geostore.FenceStorage, cover *geostore.FenceCover) error {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	return ref.UpdateFence(loopID, fs, cover)
+}
+
+// Metadata returns the current db metadata
+func (r *reloadableDB) Metadata() (*boltdb.Metadata, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	mdb, ok := ref.GeoFenceDB.(metadataDB)
+	if !ok {
+		return nil, errors.New("db has no metadata")
+	}
+	return mdb.Metadata()
+}
+
+// covererDB is a db exposing the covering settings of its fences
+type covererDB interface {
+	CovererSettings() (regionagogo.CovererSettings, error)
+}
+
+// CovererSettings returns the current db covering settings
+func (r *reloadableDB) CovererSettings() (regionagogo.CovererSettings, error) {
+	ref := r.acquire()
+	defer ref.inflight.Done()
+	cdb, ok := ref.GeoFenceDB.(covererDB)
+	if !ok {
+		return regionagogo.DefaultCovererSettings, nil
+	}
+	return cdb.CovererSettings()
+}
+
+// Close closes the current db
+func (r *reloadableDB) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cur.inflight.Wait()
+	return r.cur.Close()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/regionagogo"
+	"github.com/akhenakh/regionagogo/db/boltdb"
+	"github.com/stretchr/testify/require"
+)
+
+// squareFeature is a GeoJSON Feature of a square around 0,0
+func squareFeature(name string) string {
+	return fmt.Sprintf(`{"type":"Feature","properties":{"name":%q},"geometry":{"type":"Polygon","coordinates":[[[-1,-1],[1,-1],[1,1],[-1,1],[-1,-1]]]}}`, name)
+}
+
+// createDB writes a db at dbpath holding a square fence named name
+func createDB(t testing.TB, dbpath, name string) {
+	gs, err := boltdb.NewGeoFenceBoltDB(dbpath)
+	require.NoError(t, err)
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(squareFeature(name)), []string{"name"}, nil, nil)
+	i.FeatureImport = true
+	require.NoError(t, i.Start())
+	require.NoError(t, gs.Close())
+}
+
+// createReloadableDB returns a reloadable db serving a fence named name from a temp dir
+func createReloadableDB(t testing.TB, name string, readOnly bool) (*reloadableDB, string, func()) {
+	dir, err := ioutil.TempDir("", "testreload")
+	require.NoError(t, err)
+	dbpath := filepath.Join(dir, "region.db")
+	createDB(t, dbpath, name)
+
+	rdb, err := openReloadableDB(dbpath, readOnly, nil)
+	require.NoError(t, err)
+	return rdb, dbpath, func() {
+		rdb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// deploy replaces the file at dbpath by a new db holding a fence named name
+func deploy(t testing.TB, dbpath, name string) {
+	tmp := dbpath + ".new"
+	createDB(t, tmp, name)
+	require.NoError(t, os.Rename(tmp, dbpath))
+}
+
+// fenceName returns the name of the fence at 0,0
+func fenceName(t testing.TB, db regionagogo.GeoFenceDB) string {
+	fences, err := db.StubbingQuery(0, 0)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	return fences[0].Data["name"]
+}
+
+func TestReload(t *testing.T) {
+	for _, readOnly := range []bool{false, true} {
+		rdb, dbpath, clean := createReloadableDB(t, "old", readOnly)
+
+		require.Equal(t, "old", fenceName(t, rdb))
+
+		// the served file has not been replaced
+		require.Equal(t, errNotReplaced, rdb.Reload())
+
+		deploy(t, dbpath, "new")
+		require.NoError(t, rdb.Reload())
+		require.Equal(t, "new", fenceName(t, rdb))
+		require.Equal(t, errNotReplaced, rdb.Reload())
+
+		// the reloaded db is read only, even on a writable server
+		admin := &adminServer{server: &server{GeoFenceDB: rdb}, fields: []string{"name"}, reloader: rdb}
+		_, err := admin.addFences(strings.NewReader(squareFeature("added")))
+		require.Equal(t, boltdb.ErrReadOnly, err)
+
+		clean()
+	}
+}
+
+func TestReloadIgnoresWrites(t *testing.T) {
+	rdb, _, clean := createReloadableDB(t, "old", false)
+	defer clean()
+
+	admin := &adminServer{server: &server{GeoFenceDB: rdb}, fields: []string{"name"}, reloader: rdb}
+	count, err := admin.addFences(strings.NewReader(squareFeature("added")))
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// the admin writes change the file in place, it is still the served db
+	start := time.Now()
+	require.Equal(t, errNotReplaced, rdb.Reload())
+	require.True(t, time.Since(start) < reloadOpenTimeout)
+
+	fences, err := rdb.StubbingQuery(0, 0, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, fences, 2)
+}
+
+func TestReloadDrain(t *testing.T) {
+	rdb, dbpath, clean := createReloadableDB(t, "old", true)
+	defer clean()
+
+	// a query in flight on the old db
+	ref := rdb.acquire()
+
+	deploy(t, dbpath, "new")
+	done := make(chan error)
+	go func() {
+		done <- rdb.Reload()
+	}()
+
+	// the new db serves the new queries while the old one is draining
+	for {
+		rdb.mu.RLock()
+		swapped := rdb.cur != ref
+		rdb.mu.RUnlock()
+		if swapped {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, "new", fenceName(t, rdb))
+
+	select {
+	case <-done:
+		t.Fatal("reload returned with a query in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the old db is still open for the query in flight
+	require.Equal(t, "old", fenceName(t, ref))
+	ref.inflight.Done()
+
+	require.NoError(t, <-done)
+}
+
+func TestReloadFailure(t *testing.T) {
+	rdb, dbpath, clean := createReloadableDB(t, "old", true)
+	defer clean()
+
+	// the file is in the middle of a replacement
+	require.NoError(t, os.Rename(dbpath, dbpath+".old"))
+	err := rdb.Reload()
+	require.True(t, os.IsNotExist(err))
+	require.Equal(t, "old", fenceName(t, rdb))
+
+	// a broken file is not served
+	require.NoError(t, ioutil.WriteFile(dbpath, []byte("not a db"), 0600))
+	require.Error(t, rdb.Reload())
+	require.Equal(t, "old", fenceName(t, rdb))
+
+	// a failed reload is retried
+	require.Error(t, rdb.Reload())
+
+	deploy(t, dbpath, "new")
+	require.NoError(t, rdb.Reload())
+	require.Equal(t, "new", fenceName(t, rdb))
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
 	pb "github.com/akhenakh/regionagogo/regionagogosvc"
 	"google.golang.org/grpc"
@@ -13,6 +19,7 @@ var (
 	grpcURL = flag.String("gprcURL", "127.0.0.1:8083", "The address of the gRPC server")
 	lat     = flag.Float64("lat", 48.8, "Latitude to query")
 	lng     = flag.Float64("lng", 2.2, "Longitude to query")
+	stream  = flag.Bool("stream", false, "Stream lat,lng positions read from stdin, one per line")
 )
 
 func main() {
@@ -27,6 +34,13 @@ func main() {
 
 	client := pb.NewRegionAGogoClient(conn)
 
+	if *stream {
+		if err := streamRegions(client, os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	r, err := client.GetRegion(context.Background(), &pb.Point{Latitude: float32(*lat), Longitude: float32(*lng)})
 	if err != nil {
 		log.Fatal(err)
@@ -34,3 +48,69 @@ func main() {
 	log.Println(r)
 
 }
+
+// streamRegions sends the positions read from r over a single stream
+// and prints the responses as they are received
+func streamRegions(client pb.RegionAGogoClient, r io.Reader) error {
+	stream, err := client.StreamRegions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			res, err := stream.Recv()
+			if err == io.EOF {
+				errc <- nil
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			fmt.Println(res.Id, res.Code)
+		}
+	}()
+
+	var id uint64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p, err := parsePoint(scanner.Text())
+		if err != nil {
+			log.Println("skipping", err)
+			continue
+		}
+		id++
+		p.Id = id
+		if err := stream.Send(p); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	return <-errc
+}
+
+// parsePoint parses a lat,lng line
+func parsePoint(line string) (*pb.Point, error) {
+	parts := strings.Split(line, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid position %q", line)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 32)
+	if err != nil {
+		return nil, err
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 32)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Point{Latitude: float32(lat), Longitude: float32(lng)}, nil
+}
@@ -0,0 +1,69 @@
+package regionagogo
+
+import (
+	"errors"
+
+	"github.com/golang/geo/s2"
+)
+
+// the level of the s2 leaf cells
+const maxCellLevel = 30
+
+// ErrInvalidCoverer is returned for covering settings s2 can't use
+var ErrInvalidCoverer = errors.New("invalid coverer settings")
+
+// CovererSettings are the s2 RegionCoverer parameters used to cover the fences at import
+// a low MaxLevel and few MaxCells suit coarse datasets like countries,
+// dense datasets like cities need more and smaller cells to keep the candidates count low
+type CovererSettings struct {
+	MinLevel int `json:"min_level"`
+	MaxLevel int `json:"max_level"`
+	LevelMod int `json:"level_mod"`
+	MaxCells int `json:"max_cells"`
+}
+
+// DefaultCovererSettings are the covering settings used when none are provided
+var DefaultCovererSettings = CovererSettings{MinLevel: 1, MaxLevel: 24, LevelMod: 1, MaxCells: 32}
+
+// Validate returns ErrInvalidCoverer if the settings are out of the s2 bounds
+func (cs CovererSettings) Validate() error {
+	if cs.MinLevel < 0 || cs.MaxLevel > maxCellLevel || cs.MinLevel > cs.MaxLevel {
+		return ErrInvalidCoverer
+	}
+	if cs.LevelMod < 1 || cs.LevelMod > 3 || cs.MaxCells < 1 {
+		return ErrInvalidCoverer
+	}
+	return nil
+}
+
+// Coverer returns an s2 RegionCoverer using the settings
+func (cs CovererSettings) Coverer() *s2.RegionCoverer {
+	return &s2.RegionCoverer{
+		MinLevel: cs.MinLevel,
+		MaxLevel: cs.MaxLevel,
+		LevelMod: cs.LevelMod,
+		MaxCells: cs.MaxCells,
+	}
+}
+
+// CoverStats describes a covering, its cells count and its cells levels
+type CoverStats struct {
+	Cells    int
+	MinLevel int
+	MaxLevel int
+}
+
+// NewCoverStats returns the stats of a covering stored as cell ids
+func NewCoverStats(cells []uint64) CoverStats {
+	cs := CoverStats{Cells: len(cells)}
+	for i, c := range cells {
+		level := s2.CellID(c).Level()
+		if i == 0 || level < cs.MinLevel {
+			cs.MinLevel = level
+		}
+		if level > cs.MaxLevel {
+			cs.MaxLevel = level
+		}
+	}
+	return cs
+}
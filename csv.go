@@ -0,0 +1,96 @@
+package regionagogo
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/kpawlik/geojson"
+)
+
+// ErrInvalidCSV is returned when the CSV header does not contain the geometry column
+var ErrInvalidCSV = errors.New("invalid CSV, expecting a header with the geometry column")
+
+// streamCSV reads the rows of a CSV with a header calling fn for each row with a geometry,
+// the geometry column is a WKT or a hex encoded WKB, the other columns are the properties
+func streamCSV(r io.Reader, geometryColumn string, fn func(*geojson.Feature) error) error {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return ErrInvalidCSV
+	}
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		// spreadsheets exports start with a byte order mark
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	gi := -1
+	for j, name := range header {
+		if name == geometryColumn {
+			gi = j
+		}
+	}
+	if gi < 0 {
+		return ErrInvalidCSV
+	}
+
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		properties := make(map[string]interface{})
+		for j, v := range row {
+			if j != gi && v != "" {
+				properties[header[j]] = v
+			}
+		}
+
+		// like an invalid loop, a row with an invalid geometry is skipped
+		polygons, err := parseGeometry(row[gi])
+		if err != nil {
+			log.Println("invalid geometry on row", n, err, properties)
+			continue
+		}
+		if len(polygons) == 0 {
+			log.Println("empty geometry", properties)
+			continue
+		}
+
+		f := &geojson.Feature{
+			Type:       "Feature",
+			Geometry:   &geojson.MultiPolygon{Type: "MultiPolygon", Coordinates: polygons},
+			Properties: properties,
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// parseGeometry parses a WKT or a hex encoded WKB as exported by PostGIS
+func parseGeometry(v string) ([]geojson.MultiLine, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, nil
+	}
+
+	// bytea columns are exported with a \x prefix
+	hv := strings.TrimPrefix(v, `\x`)
+	if b, err := hex.DecodeString(hv); err == nil {
+		return ParseWKB(b)
+	}
+
+	return ParseWKT(v)
+}
@@ -8,11 +8,14 @@ import (
 	"log"
 	"math"
 	"sort"
+	"sync"
+	"time"
 
-	"github.com/Workiva/go-datastructures/augmentedtree"
 	region "github.com/akhenakh/regionagogo"
 	"github.com/akhenakh/regionagogo/geostore"
 	"github.com/boltdb/bolt"
+	"github.com/golang/geo/r1"
+	"github.com/golang/geo/s1"
 	"github.com/golang/geo/s2"
 	"github.com/golang/protobuf/proto"
 	lru "github.com/hashicorp/golang-lru"
@@ -21,22 +24,56 @@ import (
 const (
 	defaultLoopBucket       = "loop"
 	defaultCoverBucket      = "cover"
+	defaultKeyBucket        = "key"
+	defaultIndexBucket      = "index"
+	defaultMetaBucket       = "meta"
 	earthCircumferenceMeter = 40075017
+
+	// level of the cells grouping batched points for the index traversal
+	batchCellLevel = 12
+
+	// first radius explored by nearest queries, doubled until enough fences are found
+	nearestStartRadiusMeter = 1000
 )
 
 var (
+	// defaultCoverer covers the radius and nearest queries caps, it does not depend on the stored
+	// CovererSettings: candidates are found by cell ranges overlap whatever the levels of the fences covers,
+	// these settings only trade the number of candidates against the number of index lookups
 	defaultCoverer = s2.RegionCoverer{MinLevel: 1, MaxLevel: 30, MaxCells: 8}
+
+	// ErrReadOnly is returned when writing to a read only database
+	ErrReadOnly = errors.New("db is in read only mode")
 )
 
 // GeoFenceBoltDB provides an in memory index and boltdb query engine for fences lookup
+//
+// A read only GeoFenceBoltDB uses the persisted index written by BuildIndex when present,
+// instead of loading all the covers into the in memory index.
+//
+// GeoFenceBoltDB is safe for concurrent use: queries hold a read lock while
+// traversing the in memory index and reading fences, writes hold the write lock
+// from the storage transaction until the index and the cache are updated,
+// so a query sees a fence either before or after a write, never in between.
+// Fences returned by queries may be shared via the cache and must not be modified.
 type GeoFenceBoltDB struct {
-	augmentedtree.Tree
 	*bolt.DB
+	// mu protects the index and the intervals LoopIDs
+	mu          sync.RWMutex
+	idx         cellIndex
 	cache       *lru.Cache
 	loopBucket  []byte
 	coverBucket []byte
+	keyBucket   []byte
+	indexBucket []byte
+	metaBucket  []byte
 	debug       bool
 	ro          bool
+
+	// ranges is the persisted index, used instead of the in memory index when not nil
+	// it points into the bolt memory map, kept valid by the indexTx read transaction
+	ranges  *cellRanges
+	indexTx *bolt.Tx
 }
 
 // GeoSearchOption used to pass options to NewGeoSearch
@@ -47,7 +84,12 @@ type geoFenceBoltDBOptions struct {
 	debug            bool
 	loopBucket       []byte
 	coverBucket      []byte
+	keyBucket        []byte
+	indexBucket      []byte
+	metaBucket       []byte
 	ro               bool
+	openTimeout      time.Duration
+	rangeIndex       bool
 }
 
 // WithLoopBucket set the loop bucket name
@@ -64,6 +106,27 @@ func WithCoverBucket(coverBucket string) GeoFenceBoltDBOption {
 	}
 }
 
+// WithKeyBucket set the key index bucket name
+func WithKeyBucket(keyBucket string) GeoFenceBoltDBOption {
+	return func(o *geoFenceBoltDBOptions) {
+		o.keyBucket = []byte(keyBucket)
+	}
+}
+
+// WithIndexBucket set the persisted index bucket name
+func WithIndexBucket(indexBucket string) GeoFenceBoltDBOption {
+	return func(o *geoFenceBoltDBOptions) {
+		o.indexBucket = []byte(indexBucket)
+	}
+}
+
+// WithMetaBucket set the metadata bucket name
+func WithMetaBucket(metaBucket string) GeoFenceBoltDBOption {
+	return func(o *geoFenceBoltDBOptions) {
+		o.metaBucket = []byte(metaBucket)
+	}
+}
+
 // WithCachedEntries enable an LRU cache default is disabled
 func WithCachedEntries(maxCachedEntries uint) GeoFenceBoltDBOption {
 	return func(o *geoFenceBoltDBOptions) {
@@ -85,6 +148,21 @@ func WithReadOnly(ro bool) GeoFenceBoltDBOption {
 	}
 }
 
+// WithRangeIndex use a sorted cell range index instead of the augmented interval tree
+// point lookups are faster, writes are slower as the ranges are shifted
+func WithRangeIndex(rangeIndex bool) GeoFenceBoltDBOption {
+	return func(o *geoFenceBoltDBOptions) {
+		o.rangeIndex = rangeIndex
+	}
+}
+
+// WithOpenTimeout set how long to wait for the file lock when opening the db, default is to wait forever
+func WithOpenTimeout(d time.Duration) GeoFenceBoltDBOption {
+	return func(o *geoFenceBoltDBOptions) {
+		o.openTimeout = d
+	}
+}
+
 // NewGeoFenceBoltDB creates or reopen a bolt geo database
 func NewGeoFenceBoltDB(dbpath string, opts ...GeoFenceBoltDBOption) (*GeoFenceBoltDB, error) {
 	var geoOpts geoFenceBoltDBOptions
@@ -93,12 +171,19 @@ func NewGeoFenceBoltDB(dbpath string, opts ...GeoFenceBoltDBOption) (*GeoFenceBo
 		opt(&geoOpts)
 	}
 
-	db, err := bolt.Open(dbpath, 0600, &bolt.Options{ReadOnly: geoOpts.ro})
+	db, err := bolt.Open(dbpath, 0600, &bolt.Options{ReadOnly: geoOpts.ro, Timeout: geoOpts.openTimeout})
 	if err != nil {
 		return nil, err
 	}
 
-	return NewGeoFenceIdx(db, opts...)
+	gs, err := NewGeoFenceIdx(db, opts...)
+	if err != nil {
+		// release the file lock of a db we can't use
+		db.Close()
+		return nil, err
+	}
+
+	return gs, nil
 }
 
 // NewGeoFenceIdx a geo index over a BoltDB storage
@@ -110,12 +195,20 @@ func NewGeoFenceIdx(db *bolt.DB, opts ...GeoFenceBoltDBOption) (*GeoFenceBoltDB,
 	}
 
 	gs := &GeoFenceBoltDB{
-		Tree:        augmentedtree.New(1),
 		DB:          db,
 		debug:       geoOpts.debug,
 		ro:          geoOpts.ro,
 		loopBucket:  geoOpts.loopBucket,
 		coverBucket: geoOpts.coverBucket,
+		keyBucket:   geoOpts.keyBucket,
+		indexBucket: geoOpts.indexBucket,
+		metaBucket:  geoOpts.metaBucket,
+	}
+
+	if geoOpts.rangeIndex {
+		gs.idx = newRangeIndex()
+	} else {
+		gs.idx = newTreeIndex(geoOpts.debug)
 	}
 
 	if geoOpts.maxCachedEntries != 0 {
@@ -134,6 +227,18 @@ func NewGeoFenceIdx(db *bolt.DB, opts ...GeoFenceBoltDBOption) (*GeoFenceBoltDB,
 		gs.coverBucket = []byte(defaultCoverBucket)
 	}
 
+	if len(gs.keyBucket) == 0 {
+		gs.keyBucket = []byte(defaultKeyBucket)
+	}
+
+	if len(gs.indexBucket) == 0 {
+		gs.indexBucket = []byte(defaultIndexBucket)
+	}
+
+	if len(gs.metaBucket) == 0 {
+		gs.metaBucket = []byte(defaultMetaBucket)
+	}
+
 	// create bucket if we have write permission
 	if !geoOpts.ro {
 		if errdb := db.Update(func(tx *bolt.Tx) error {
@@ -143,12 +248,33 @@ func NewGeoFenceIdx(db *bolt.DB, opts ...GeoFenceBoltDBOption) (*GeoFenceBoltDB,
 			if _, errtx := tx.CreateBucketIfNotExists(gs.coverBucket); errtx != nil {
 				return fmt.Errorf("create bucket: %s", errtx)
 			}
+			if _, errtx := tx.CreateBucketIfNotExists(gs.keyBucket); errtx != nil {
+				return fmt.Errorf("create bucket: %s", errtx)
+			}
+			if _, errtx := tx.CreateBucketIfNotExists(gs.indexBucket); errtx != nil {
+				return fmt.Errorf("create bucket: %s", errtx)
+			}
+			if _, errtx := tx.CreateBucketIfNotExists(gs.metaBucket); errtx != nil {
+				return fmt.Errorf("create bucket: %s", errtx)
+			}
 			return nil
 		}); errdb != nil {
 			return nil, errdb
 		}
 	}
 
+	if err := gs.checkFormat(); err != nil {
+		return nil, err
+	}
+
+	// any write removes the persisted index, when present it is up to date
+	if err := gs.openRanges(); err != nil {
+		return nil, err
+	}
+	if gs.ranges != nil {
+		return gs, nil
+	}
+
 	if err := gs.importGeoData(); err != nil {
 		return nil, err
 	}
@@ -156,49 +282,110 @@ func NewGeoFenceIdx(db *bolt.DB, opts ...GeoFenceBoltDBOption) (*GeoFenceBoltDB,
 	return gs, nil
 }
 
-// index indexes each cells of the cover and set its loopID
-func (gs *GeoFenceBoltDB) index(fc *geostore.FenceCover, loopID uint64) {
-	for _, cell := range fc.Cellunion {
-		s2interval := &region.S2Interval{CellID: s2.CellID(cell)}
-		intervals := gs.Query(s2interval)
-		found := false
-
-		if len(intervals) != 0 {
-			for _, existInterval := range intervals {
-				if existInterval.LowAtDimension(1) == s2interval.LowAtDimension(1) &&
-					existInterval.HighAtDimension(1) == s2interval.HighAtDimension(1) {
-					// update existing interval
-					existS2Interval := existInterval.(*region.S2Interval)
-					if gs.debug {
-						log.Printf("added %d to existing interval %s containing %v", loopID, existS2Interval, existS2Interval.LoopIDs)
-					}
-
-					existS2Interval.LoopIDs = append(existS2Interval.LoopIDs, loopID)
-					found = true
-					break
-				}
+// openRanges uses the persisted index if any
+// a read transaction keeps it valid until the db is closed or, for a writable db, until its first write
+func (gs *GeoFenceBoltDB) openRanges() error {
+	tx, err := gs.Begin(false)
+	if err != nil {
+		return err
+	}
+
+	var v []byte
+	if b := tx.Bucket(gs.indexBucket); b != nil {
+		v = b.Get(rangesKey)
+	}
+	if v == nil {
+		return tx.Rollback()
+	}
+
+	ranges, err := newCellRanges(v)
+	if err != nil {
+		// an index from another version is ignored, the covers are loaded instead
+		log.Println("ignoring persisted index", err)
+		return tx.Rollback()
+	}
+
+	gs.ranges = ranges
+	gs.indexTx = tx
+	log.Println("using persisted index of", ranges.n, "ranges")
+
+	return nil
+}
+
+// releaseRanges switches from the persisted index to the in memory index before a write,
+// the read transaction of the persisted index would prevent bolt from growing its file
+// gs.mu must be held
+func (gs *GeoFenceBoltDB) releaseRanges() error {
+	if gs.ranges == nil {
+		return nil
+	}
+
+	if err := gs.indexTx.Rollback(); err != nil {
+		return err
+	}
+	gs.indexTx = nil
+	gs.ranges = nil
+
+	return gs.importGeoData()
+}
+
+// BuildIndex writes the persisted index of all the stored covers
+// any later write to the db removes it, it should be called once the import is done
+func (gs *GeoFenceBoltDB) BuildIndex() error {
+	if gs.ro {
+		return ErrReadOnly
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.releaseRanges(); err != nil {
+		return err
+	}
+
+	return gs.Update(func(tx *bolt.Tx) error {
+		var entries []cellEntry
+		var fc geostore.FenceCover
+		cur := tx.Bucket(gs.coverBucket).Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if err := proto.Unmarshal(v, &fc); err != nil {
+				return err
 			}
+			loopID := binary.BigEndian.Uint64(k)
+			entries = appendCoverEntries(entries, &fc, loopID)
 		}
 
-		if !found {
-			// create new interval with current loop
-			s2interval.LoopIDs = []uint64{loopID}
-			gs.Add(s2interval)
-			if gs.debug {
-				log.Printf("added %v to new interval %s", s2interval.LoopIDs, s2interval)
-			}
+		data := buildCellRanges(entries)
+		if gs.debug {
+			log.Println("built persisted index of", len(data), "bytes")
 		}
+
+		return tx.Bucket(gs.indexBucket).Put(rangesKey, data)
+	})
+}
+
+// Close releases the persisted index and closes the db
+func (gs *GeoFenceBoltDB) Close() error {
+	if gs.indexTx != nil {
+		if err := gs.indexTx.Rollback(); err != nil {
+			return err
+		}
+		gs.indexTx = nil
+		gs.ranges = nil
 	}
+
+	return gs.DB.Close()
 }
 
-// importGeoData loads all existing cells into the segment tree
+// importGeoData loads all existing cells into the index
+// gs.mu must be held once the db is shared
 func (gs *GeoFenceBoltDB) importGeoData() error {
 	var count int
 	err := gs.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(gs.coverBucket)
 		cur := b.Cursor()
 
-		// load the cell ranges into the tree
+		var entries []cellEntry
 		var fc geostore.FenceCover
 		for k, v := cur.First(); k != nil; k, v = cur.Next() {
 			count++
@@ -218,9 +405,11 @@ func (gs *GeoFenceBoltDB) importGeoData() error {
 				return err
 			}
 
-			gs.index(&fc, loopID)
+			entries = appendCoverEntries(entries, &fc, loopID)
 		}
 
+		gs.idx.load(entries)
+
 		return nil
 	})
 	if err != nil {
@@ -236,8 +425,50 @@ func (gs *GeoFenceBoltDB) importGeoData() error {
 	return nil
 }
 
+// candidates returns the loopIDs of all the intervals overlapping the cell
+// loopIDs are copied so they can be used once the read lock is released
+func (gs *GeoFenceBoltDB) candidates(c s2.CellID) []uint64 {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	if gs.ranges != nil {
+		var loopIDs []uint64
+		for _, r := range gs.ranges.overlapping(c) {
+			loopIDs = append(loopIDs, r.loopIDs...)
+		}
+		return loopIDs
+	}
+
+	var loopIDs []uint64
+	for _, itv := range gs.idx.overlapping(c) {
+		if gs.debug {
+			log.Println("found possible solution", itv.min, itv.max, itv.loopIDs)
+		}
+		loopIDs = append(loopIDs, itv.loopIDs...)
+	}
+
+	return loopIDs
+}
+
+// intervals returns the cell ranges and loopIDs of all the intervals overlapping the cell
+// loopIDs slices are never modified in place by the index, they can be used once the read lock is released
+func (gs *GeoFenceBoltDB) intervals(c s2.CellID) []cellLoops {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	if gs.ranges != nil {
+		return gs.ranges.overlapping(c)
+	}
+
+	return gs.idx.overlapping(c)
+}
+
 // FenceByID returns a region from DB by its id
 func (gs *GeoFenceBoltDB) FenceByID(loopID uint64) *region.Fence {
+	// prevent a write to happen between the storage read and the cache update
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
 	// TODO: refactor as Fence ?
 	if gs.cache != nil {
 		if val, ok := gs.cache.Get(loopID); ok {
@@ -266,80 +497,205 @@ func (gs *GeoFenceBoltDB) FenceByID(loopID uint64) *region.Fence {
 		return nil
 	}
 	r := region.NewFenceFromStorage(rs)
+	if r != nil {
+		r.ID = loopID
+	}
 	if gs.cache != nil && r != nil {
 		gs.cache.Add(loopID, r)
 	}
 	return r
 }
 
+// FenceByKey returns a region from DB by its user supplied key
+func (gs *GeoFenceBoltDB) FenceByKey(key string) *region.Fence {
+	var loopID uint64
+	gs.mu.RLock()
+	err := gs.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(gs.keyBucket)
+		// databases created before keys support have no key bucket
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(key))
+		if len(v) != 8 {
+			return nil
+		}
+		loopID = binary.BigEndian.Uint64(v)
+		return nil
+	})
+	gs.mu.RUnlock()
+	if err != nil || loopID == 0 {
+		return nil
+	}
+	return gs.FenceByID(loopID)
+}
+
 // StubbingQuery returns the fence for the corresponding lat, lng point
 func (gs *GeoFenceBoltDB) StubbingQuery(lat, lng float64, opts ...region.QueryOptionsFunc) (region.Fences, error) {
 	// the CellID at L30
 	q := s2.CellIDFromLatLng(s2.LatLngFromDegrees(lat, lng))
 
-	i := &region.S2Interval{CellID: q}
-
 	if gs.debug {
 		log.Println("lookup", lat, lng, q)
 	}
-	r := gs.Tree.Query(i)
 
-	var foundFence *region.Fence
+	var queryOpts region.QueryOptions
+	for _, opt := range opts {
+		opt(&queryOpts)
+	}
 
+	loopIDs, interior := pointLoops(gs.intervals(q), q)
+
+	return gs.stubbingQuery(lat, lng, loopIDs, interior, gs.FenceByID, queryOpts), nil
+}
+
+// BatchStubbingQuery returns the fences for each point, in the same order as points
+// points are processed in cell ID order, nearby points share one index traversal and the fences loads
+func (gs *GeoFenceBoltDB) BatchStubbingQuery(points []region.LatLng, opts ...region.QueryOptionsFunc) ([]region.Fences, error) {
 	var queryOpts region.QueryOptions
 	for _, opt := range opts {
 		opt(&queryOpts)
 	}
 
+	cells := make([]s2.CellID, len(points))
+	order := make([]int, len(points))
+	for i, p := range points {
+		cells[i] = s2.CellIDFromLatLng(s2.LatLngFromDegrees(p.Lat, p.Lng))
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return cells[order[a]] < cells[order[b]] })
+
+	fences := make(map[uint64]*region.Fence)
+	fenceByID := func(loopID uint64) *region.Fence {
+		if f, ok := fences[loopID]; ok {
+			return f
+		}
+		f := gs.FenceByID(loopID)
+		fences[loopID] = f
+		return f
+	}
+
+	res := make([]region.Fences, len(points))
+
+	var parent s2.CellID
+	var intervals []cellLoops
+	for _, i := range order {
+		q := cells[i]
+
+		// the intervals overlapping the parent cell include the ones overlapping q
+		if p := q.Parent(batchCellLevel); p != parent {
+			parent = p
+			intervals = gs.intervals(p)
+		}
+
+		loopIDs, interior := pointLoops(intervals, q)
+
+		res[i] = gs.stubbingQuery(points[i].Lat, points[i].Lng, loopIDs, interior, fenceByID, queryOpts)
+	}
+
+	return res, nil
+}
+
+// pointLoops returns the loopIDs of the intervals containing the leaf cell q
+// and, among them, the loopIDs whose interior covering contains q
+func pointLoops(intervals []cellLoops, q s2.CellID) ([]uint64, []uint64) {
+	var loopIDs, interior []uint64
+	for _, itv := range intervals {
+		if itv.min <= q && q <= itv.max {
+			loopIDs = append(loopIDs, itv.loopIDs...)
+			interior = append(interior, itv.interior...)
+		}
+	}
+	return loopIDs, interior
+}
+
+// stubbingQuery returns the fences containing the point among the loopIDs candidates
+// the interior loopIDs are known to contain the point and skip the point in polygon test
+// fences are loaded using fenceByID
+func (gs *GeoFenceBoltDB) stubbingQuery(lat, lng float64, loopIDs, interior []uint64, fenceByID func(uint64) *region.Fence, queryOpts region.QueryOptions) region.Fences {
+	q := s2.CellIDFromLatLng(s2.LatLngFromDegrees(lat, lng))
+
+	var foundFence *region.Fence
+
 	var res []*region.Fence
 
-	for _, itv := range r {
-		sitv := itv.(*region.S2Interval)
-		if gs.debug {
-			log.Println("found possible solution", sitv, sitv.LoopIDs)
+	// a fence is tested only once even if present in several intervals
+	seen := make(map[uint64]struct{})
+
+	for _, loopID := range loopIDs {
+		if _, ok := seen[loopID]; ok {
+			continue
 		}
+		seen[loopID] = struct{}{}
 
-		for _, loopID := range sitv.LoopIDs {
-			fence := gs.FenceByID(loopID)
-			if fence != nil && fence.Loop.ContainsPoint(q.Point()) {
-				res = append(res, fence)
-				if foundFence == nil {
-					if gs.debug {
-						log.Println("found matching fence", sitv, sitv.LoopIDs, fence.Loop.NumEdges())
-					}
-					foundFence = fence
-					continue
+		fence := fenceByID(loopID)
+		if fence != nil && (containsLoopID(interior, loopID) || fence.Polygon.ContainsPoint(q.Point())) {
+			res = append(res, fence)
+			if foundFence == nil {
+				if gs.debug {
+					log.Println("found matching fence", loopID, fence.Polygon.NumEdges())
 				}
+				foundFence = fence
+				continue
+			}
 
-				// a fence can include a smaller fence
-				// return only the one that is contained in the other if asked
-				if !queryOpts.MultipleFences {
-					// we take the 1st vertex of the fence.Loop if it is contained in previousLoop
-					// region loop  is more precise
-					if foundFence.Loop.ContainsPoint(fence.Loop.Vertex(0)) {
-						foundFence = fence
-					}
+			// a fence can include a smaller fence
+			// return only the one that is contained in the other if asked
+			if !queryOpts.MultipleFences {
+				// we take the 1st vertex of the fence exterior loop if it is contained in previous fence
+				// region polygon is more precise
+				if foundFence.Polygon.ContainsPoint(fence.Polygon.Loop(0).Vertex(0)) {
+					foundFence = fence
 				}
 			}
-
 		}
-
 	}
 
 	if !queryOpts.MultipleFences && foundFence != nil {
-		return []*region.Fence{foundFence}, nil
+		res = []*region.Fence{foundFence}
 	}
 
 	// Order fences by their size
 	sort.Sort(sort.Reverse(region.BySize(res)))
 
-	return res, nil
+	if queryOpts.BoundaryDistance {
+		p := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
+		for i, fence := range res {
+			res[i] = withBoundary(fence, p)
+		}
+	}
+
+	return res
+}
+
+// withBoundary returns a copy of fence with the distance from p to its boundary
+// fences are shared through the cache, never modify them
+func withBoundary(fence *region.Fence, p s2.Point) *region.Fence {
+	cp, d := fence.ClosestBoundaryPoint(p)
+	ll := s2.LatLngFromPoint(cp)
+
+	f := *fence
+	f.BoundaryDistance = angleToMeters(d)
+	f.BoundaryPoint = &region.LatLng{Lat: ll.Lat.Degrees(), Lng: ll.Lng.Degrees()}
+	return &f
 }
 
 // RectQuery perform rectangular query ur upper right bl bottom left
+// by default fences whose bounding rect is inside the query rect are returned,
+// with an exact relation the fences geometry is tested against the rect
 func (gs *GeoFenceBoltDB) RectQuery(urlat, urlng, bllat, bllng float64, opts ...region.QueryOptionsFunc) (region.Fences, error) {
-	rect := s2.RectFromLatLng(s2.LatLngFromDegrees(bllat, bllng))
-	rect = rect.AddPoint(s2.LatLngFromDegrees(urlat, urlng))
+	var queryOpts region.QueryOptions
+	for _, opt := range opts {
+		opt(&queryOpts)
+	}
+
+	// the longitudes go east from bl to ur, the rect may be wider than 180° or cross the antimeridian
+	rect := s2.Rect{
+		Lat: r1.IntervalFromPoint((s1.Angle(bllat) * s1.Degree).Radians()).
+			AddPoint((s1.Angle(urlat) * s1.Degree).Radians()),
+		Lng: s1.IntervalFromEndpoints((s1.Angle(bllng) * s1.Degree).Radians(),
+			(s1.Angle(urlng) * s1.Degree).Radians()),
+	}
 
 	rc := &s2.RegionCoverer{MaxLevel: 30, MaxCells: 4}
 	covering := rc.Covering(rect)
@@ -348,24 +704,38 @@ func (gs *GeoFenceBoltDB) RectQuery(urlat, urlng, bllat, bllng float64, opts ...
 	}
 
 	fences := make(map[uint64]*region.Fence)
+	seen := make(map[uint64]struct{})
 	for _, c := range covering {
-		i := &region.S2Interval{CellID: c}
-		r := gs.Tree.Query(i)
-
-		for _, itv := range r {
-			sitv := itv.(*region.S2Interval)
-			for _, loopID := range sitv.LoopIDs {
-				var region *region.Fence
-				if v, ok := fences[loopID]; ok {
-					region = v
-				} else {
-					region = gs.FenceByID(loopID)
-					// testing the found loop is actually inside the rect
-					// (since we are using only one large cover it may be outside)
-					if rect.Contains(region.Loop.RectBound()) {
-						fences[loopID] = region
-					}
-				}
+		for _, loopID := range gs.candidates(c) {
+			if _, ok := seen[loopID]; ok {
+				continue
+			}
+			seen[loopID] = struct{}{}
+
+			fence := gs.FenceByID(loopID)
+			if fence == nil {
+				continue
+			}
+
+			var match bool
+			switch queryOpts.Relation {
+			case region.Approximate:
+				// testing the found loop is actually inside the rect
+				// (since we are using only one large cover it may be outside)
+				match = rect.Contains(fence.Polygon.RectBound())
+			case region.Within:
+				// the bounding rect follows the geodesic edges of the fence
+				match = rect.Contains(fence.Polygon.RectBound())
+			case region.Intersects:
+				match = rectIntersects(rect, fence.Polygon)
+			case region.Contains:
+				match = rectContained(rect, fence.Polygon)
+			default:
+				return nil, region.ErrUnsupportedRelation
+			}
+
+			if match {
+				fences[loopID] = fence
 			}
 		}
 	}
@@ -378,9 +748,26 @@ func (gs *GeoFenceBoltDB) RectQuery(urlat, urlng, bllat, bllng float64, opts ...
 }
 
 // RadiusQuery is performing a radius query
+// by default fences whose cover touches the cap cover are returned,
+// with an exact relation the fences are tested against the cap and returned with their distance to the center, nearest first
 func (gs *GeoFenceBoltDB) RadiusQuery(lat, lng, radius float64, opts ...region.QueryOptionsFunc) (region.Fences, error) {
+	var queryOpts region.QueryOptions
+	for _, opt := range opts {
+		opt(&queryOpts)
+	}
+
+	switch queryOpts.Relation {
+	case region.Approximate, region.Intersects, region.Within, region.Contains:
+	default:
+		return nil, region.ErrUnsupportedRelation
+	}
+
 	center := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
 	cap := s2.CapFromCenterArea(center, s2RadialAreaMeters(radius))
+	if queryOpts.Relation != region.Approximate {
+		// the area cap is only exact for small radiuses, the exact relations need the real radius
+		cap = s2.CapFromCenterAngle(center, metersToAngle(radius))
+	}
 	covering := defaultCoverer.Covering(cap)
 
 	var res []*region.Fence
@@ -388,80 +775,418 @@ func (gs *GeoFenceBoltDB) RadiusQuery(lat, lng, radius float64, opts ...region.Q
 	fencesIds := make(map[uint64]struct{})
 
 	for _, cellID := range covering {
-		i := &region.S2Interval{CellID: cellID}
-		r := gs.Tree.Query(i)
-
-		for _, itv := range r {
-			sitv := itv.(*region.S2Interval)
-			for _, loopID := range sitv.LoopIDs {
-				fencesIds[loopID] = struct{}{}
-			}
+		for _, loopID := range gs.candidates(cellID) {
+			fencesIds[loopID] = struct{}{}
 		}
 	}
 
 	for k := range fencesIds {
 		fence := gs.FenceByID(k)
-		if fence != nil {
+		if fence == nil {
+			continue
+		}
+
+		if queryOpts.Relation == region.Approximate {
 			res = append(res, fence)
+			continue
+		}
+
+		d := fence.DistanceToPoint(center)
+		if d > cap.Radius() {
+			continue
+		}
+		if queryOpts.Relation == region.Within && !fence.WithinCap(cap) {
+			continue
 		}
+		// the fence contains the cap when the center is inside and no edge crosses the cap
+		if queryOpts.Relation == region.Contains && (d > 0 || fence.DistanceToBoundary(center) < cap.Radius()) {
+			continue
+		}
+
+		// fences are shared through the cache, never modify them
+		f := *fence
+		f.Distance = angleToMeters(d)
+		res = append(res, &f)
+	}
+
+	if queryOpts.Relation != region.Approximate {
+		sort.Sort(region.ByDistance(res))
 	}
 
 	return res, nil
 }
 
+// NearestQuery returns the k fences closest to the position, nearest first
+// the index is explored through growing caps around the position until k fences are closer than the cap radius
+func (gs *GeoFenceBoltDB) NearestQuery(lat, lng float64, k int, maxDistance float64) (region.Fences, error) {
+	if k < 1 {
+		return nil, errors.New("k must be positive")
+	}
+
+	center := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
+
+	maxAngle := s1.Angle(math.Pi)
+	if maxDistance > 0 && metersToAngle(maxDistance) < maxAngle {
+		maxAngle = metersToAngle(maxDistance)
+	}
+
+	// fences already measured, nil for fences missing from the DB
+	found := make(map[uint64]*region.Fence)
+	distances := make(map[uint64]s1.Angle)
+
+	radius := metersToAngle(nearestStartRadiusMeter)
+	for {
+		if radius > maxAngle {
+			radius = maxAngle
+		}
+
+		cap := s2.CapFromCenterAngle(center, radius)
+		for _, c := range defaultCoverer.Covering(cap) {
+			for _, loopID := range gs.candidates(c) {
+				if _, ok := found[loopID]; ok {
+					continue
+				}
+
+				fence := gs.FenceByID(loopID)
+				found[loopID] = fence
+				if fence != nil {
+					distances[loopID] = fence.DistanceToPoint(center)
+				}
+			}
+		}
+
+		// a fence not found yet is farther than the cap radius
+		var closer int
+		for _, d := range distances {
+			if d <= radius {
+				closer++
+			}
+		}
+
+		if closer >= k || radius >= maxAngle {
+			break
+		}
+		radius *= 2
+	}
+
+	var res []*region.Fence
+	for loopID, d := range distances {
+		if d > maxAngle {
+			continue
+		}
+		// fences are shared through the cache, never modify them
+		f := *found[loopID]
+		f.Distance = angleToMeters(d)
+		res = append(res, &f)
+	}
+
+	sort.Sort(region.ByDistance(res))
+	if len(res) > k {
+		res = res[:k]
+	}
+
+	return res, nil
+}
+
+// angleToMeters converts an angle on the earth surface to meters
+func angleToMeters(a s1.Angle) float64 {
+	return a.Radians() * earthCircumferenceMeter / (2 * math.Pi)
+}
+
+// metersToAngle converts a distance in meters on the earth surface to an angle
+func metersToAngle(m float64) s1.Angle {
+	return s1.Angle(m / earthCircumferenceMeter * 2 * math.Pi)
+}
+
 func s2RadialAreaMeters(radius float64) float64 {
 	r := (radius / earthCircumferenceMeter) * math.Pi * 2
 	return (math.Pi * r * r)
 }
 
 // StoreFence stores a fence into the database and load its index in memory
-func (gs *GeoFenceBoltDB) StoreFence(fs *geostore.FenceStorage, cover []uint64) error {
+func (gs *GeoFenceBoltDB) StoreFence(fs *geostore.FenceStorage, fc *geostore.FenceCover) error {
+	return gs.StoreFences([]*geostore.FenceStorage{fs}, []*geostore.FenceCover{fc})
+}
+
+// StoreFences stores fences and their covers in a single transaction and load their index in memory
+// either all the fences are stored or none, fss and fcs must have the same length
+func (gs *GeoFenceBoltDB) StoreFences(fss []*geostore.FenceStorage, fcs []*geostore.FenceCover) error {
 	if gs.ro {
-		return errors.New("db is in read only mode")
+		return ErrReadOnly
 	}
-	return gs.Update(func(tx *bolt.Tx) error {
+
+	if len(fss) != len(fcs) {
+		return errors.New("fences and covers count mismatch")
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.releaseRanges(); err != nil {
+		return err
+	}
+
+	loopIDs := make([]uint64, len(fss))
+
+	err := gs.Update(func(tx *bolt.Tx) error {
 		loopB := tx.Bucket(gs.loopBucket)
 		coverBucket := tx.Bucket(gs.coverBucket)
+		keyB := tx.Bucket(gs.keyBucket)
 
-		loopID, err := loopB.NextSequence()
-		if err != nil {
+		// the persisted index is outdated by any write
+		if err := tx.Bucket(gs.indexBucket).Delete(rangesKey); err != nil {
 			return err
 		}
 
-		buf, err := proto.Marshal(fs)
+		for n, fs := range fss {
+			fc := fcs[n]
+
+			if fs.Key != "" && keyB.Get([]byte(fs.Key)) != nil {
+				return region.ErrKeyExists
+			}
+
+			loopID, err := loopB.NextSequence()
+			if err != nil {
+				return err
+			}
+			loopIDs[n] = loopID
+
+			buf, err := proto.Marshal(fs)
+			if err != nil {
+				return err
+			}
+
+			if gs.debug {
+				log.Println("inserted", loopID, fs.Data, fc.Cellunion)
+			}
+
+			// convert our loopID to bigendian to be used as key
+			k := itob(loopID)
+
+			err = loopB.Put(k, buf)
+			if err != nil {
+				return err
+			}
+
+			if fs.Key != "" {
+				if err := keyB.Put([]byte(fs.Key), k); err != nil {
+					return err
+				}
+			}
+
+			// inserting into cover index using the same key
+			bufc, err := proto.Marshal(fc)
+			if err != nil {
+				return err
+			}
+
+			if err := coverBucket.Put(k, bufc); err != nil {
+				return err
+			}
+		}
+
+		return gs.addFenceCount(tx, len(fss))
+	})
+	if err != nil {
+		return err
+	}
+
+	// also load into memory once stored
+	for n, fc := range fcs {
+		gs.idx.add(fc, loopIDs[n])
+	}
+
+	return nil
+}
+
+// itob returns an 8-byte big endian representation of v.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// DeleteFence removes a fence from the database and its index from memory
+func (gs *GeoFenceBoltDB) DeleteFence(loopID uint64) error {
+	if gs.ro {
+		return ErrReadOnly
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.releaseRanges(); err != nil {
+		return err
+	}
+
+	var fc *geostore.FenceCover
+
+	err := gs.Update(func(tx *bolt.Tx) error {
+		loopB := tx.Bucket(gs.loopBucket)
+		coverBucket := tx.Bucket(gs.coverBucket)
+		keyB := tx.Bucket(gs.keyBucket)
+
+		// the persisted index is outdated by any write
+		if err := tx.Bucket(gs.indexBucket).Delete(rangesKey); err != nil {
+			return err
+		}
+
+		k := itob(loopID)
+
+		var err error
+		fc, err = coverFromBucket(coverBucket, k)
 		if err != nil {
 			return err
 		}
 
+		if err := deleteKey(loopB, keyB, k); err != nil {
+			return err
+		}
+
+		if err := loopB.Delete(k); err != nil {
+			return err
+		}
+
+		if err := coverBucket.Delete(k); err != nil {
+			return err
+		}
+
 		if gs.debug {
-			log.Println("inserted", loopID, fs.Data, cover)
+			log.Println("deleted", loopID)
+		}
+
+		return gs.addFenceCount(tx, -1)
+	})
+	if err != nil {
+		return err
+	}
+
+	// also remove from memory once deleted
+	gs.idx.remove(fc, loopID)
+	if gs.cache != nil {
+		gs.cache.Remove(loopID)
+	}
+
+	return nil
+}
+
+// UpdateFence replaces a fence stored in the database and reload its index in memory
+func (gs *GeoFenceBoltDB) UpdateFence(loopID uint64, fs *geostore.FenceStorage, fc *geostore.FenceCover) error {
+	if gs.ro {
+		return ErrReadOnly
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.releaseRanges(); err != nil {
+		return err
+	}
+
+	var oldfc *geostore.FenceCover
+
+	err := gs.Update(func(tx *bolt.Tx) error {
+		loopB := tx.Bucket(gs.loopBucket)
+		coverBucket := tx.Bucket(gs.coverBucket)
+		keyB := tx.Bucket(gs.keyBucket)
+
+		// the persisted index is outdated by any write
+		if err := tx.Bucket(gs.indexBucket).Delete(rangesKey); err != nil {
+			return err
 		}
 
-		// convert our loopID to bigendian to be used as key
 		k := itob(loopID)
 
-		err = loopB.Put(k, buf)
+		var err error
+		oldfc, err = coverFromBucket(coverBucket, k)
 		if err != nil {
 			return err
 		}
 
-		// inserting into cover index using the same key
-		fc := &geostore.FenceCover{Cellunion: cover}
+		if fs.Key != "" {
+			if v := keyB.Get([]byte(fs.Key)); v != nil && !bytes.Equal(v, k) {
+				return region.ErrKeyExists
+			}
+		}
+
+		if err := deleteKey(loopB, keyB, k); err != nil {
+			return err
+		}
+
+		buf, err := proto.Marshal(fs)
+		if err != nil {
+			return err
+		}
+
+		if err := loopB.Put(k, buf); err != nil {
+			return err
+		}
+
+		if fs.Key != "" {
+			if err := keyB.Put([]byte(fs.Key), k); err != nil {
+				return err
+			}
+		}
+
 		bufc, err := proto.Marshal(fc)
 		if err != nil {
 			return err
 		}
 
-		// also load into memory
-		gs.index(fc, loopID)
+		if err := coverBucket.Put(k, bufc); err != nil {
+			return err
+		}
+
+		if gs.debug {
+			log.Println("updated", loopID, fs.Data, fc.Cellunion)
+		}
 
-		return coverBucket.Put(k, bufc)
+		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// also replace in memory once stored
+	gs.idx.remove(oldfc, loopID)
+	gs.idx.add(fc, loopID)
+	if gs.cache != nil {
+		gs.cache.Remove(loopID)
+	}
+
+	return nil
 }
 
-// itob returns an 8-byte big endian representation of v.
-func itob(v uint64) []byte {
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, v)
-	return b
+// deleteKey removes the key index entry of the fence stored under k if any
+func deleteKey(loopB, keyB *bolt.Bucket, k []byte) error {
+	v := loopB.Get(k)
+	if v == nil {
+		return nil
+	}
+
+	var fs geostore.FenceStorage
+	if err := proto.Unmarshal(v, &fs); err != nil {
+		return err
+	}
+
+	if fs.Key == "" {
+		return nil
+	}
+
+	return keyB.Delete([]byte(fs.Key))
+}
+
+// coverFromBucket reads back the FenceCover stored under k
+func coverFromBucket(b *bolt.Bucket, k []byte) (*geostore.FenceCover, error) {
+	v := b.Get(k)
+	if v == nil {
+		return nil, region.ErrFenceNotFound
+	}
+
+	var fc geostore.FenceCover
+	if err := proto.Unmarshal(v, &fc); err != nil {
+		return nil, err
+	}
+
+	return &fc, nil
 }
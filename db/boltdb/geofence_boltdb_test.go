@@ -1,15 +1,27 @@
 package boltdb
 
 import (
+	"archive/zip"
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/akhenakh/regionagogo"
 	"github.com/akhenakh/regionagogo/geostore"
+	"github.com/boltdb/bolt"
+	"github.com/golang/geo/s1"
 	"github.com/golang/geo/s2"
+	"github.com/golang/protobuf/proto"
+	"github.com/kpawlik/geojson"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,6 +53,8 @@ const (
 	geoJSONIsland      = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"stroke":"#555555","stroke-width":2,"stroke-opacity":1,"fill":"#555555","fill-opacity":0.5,"name":"Ile d'Orléans"},"geometry":{"type":"MultiPolygon","coordinates":[[[[-71.17218017578125,46.841407127005866],[-71.17218017578125,47.040182144806664],[-70.784912109375,47.040182144806664],[-70.784912109375,46.841407127005866],[-71.17218017578125,46.841407127005866]]]]}}]}`
 	geoJSONoverlapping = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"stroke":"#555555","stroke-width":2,"stroke-opacity":1,"fill":"#555555","fill-opacity":0.5,"name":"outter"},"geometry":{"type":"Polygon","coordinates":[[[2.253570556640625,48.80505453139158],[2.253570556640625,48.90128927649513],[2.429351806640625,48.90128927649513],[2.429351806640625,48.80505453139158],[2.253570556640625,48.80505453139158]]]}},{"type":"Feature","properties":{"stroke":"#555555","stroke-width":2,"stroke-opacity":1,"fill":"#555555","fill-opacity":0.5,"name":"inner"},"geometry":{"type":"Polygon","coordinates":[[[2.267303466796875,48.83353759505566],[2.267303466796875,48.87555444355432],[2.37030029296875,48.87555444355432],[2.37030029296875,48.83353759505566],[2.267303466796875,48.83353759505566]]]}},{"type":"Feature","properties":{"stroke":"#555555","stroke-width":2,"stroke-opacity":1,"fill":"#555555","fill-opacity":0.5,"name":"bigoutter"},"geometry":{"type":"Polygon","coordinates":[[[2.208251953125,48.78605682994539],[2.208251953125,48.9211457038064],[2.45819091796875,48.9211457038064],[2.45819091796875,48.78605682994539],[2.208251953125,48.78605682994539]]]}}]}`
 	geoJSONbadcover    = `{"type":"FeatureCollection","crs":{"type":"name","properties":{"name":"urn:ogc:def:crs:OGC:1.3:CRS84"}},"features":[{"type":"Feature","properties":{"fid":4740,"ID_0":79,"ISO":"FRA","NAME_0":"France","ID_1":4,"NAME_1":"Île-de-France","ID_2":13,"NAME_2":"Hauts-de-Seine","ID_3":52,"NAME_3":"Nanterre","ID_4":524,"NAME_4":"Rueil-Malmaison","ID_5":4740,"NAME_5":"Rueil-Malmaison","CCN_5":null,"CCA_5":null,"TYPE_5":"Chef-lieu canton","ENGTYPE_5":"Commune","Shape_Length":0.17305815277123773,"Shape_Area":0.0017781421356630909},"geometry":{"type":"MultiPolygon","coordinates":[[[[2.197860956192073,48.854763031005973],[2.182619333267212,48.851566314697209],[2.159867525100708,48.847721099853629],[2.150411605834961,48.858501434326172],[2.153764247894401,48.864406585693359],[2.150387287140006,48.870868682861328],[2.158314466476384,48.880607604980582],[2.16934871673584,48.895812988281307],[2.207759618759155,48.874229431152344],[2.211281538009644,48.86854171752924],[2.200677394867057,48.86307525634777],[2.203563690185547,48.860630035400447],[2.197860956192073,48.854763031005973]]]]}},{"type":"Feature","properties":{"fid":5756,"ID_0":79,"ISO":"FRA","NAME_0":"France","ID_1":4,"NAME_1":"Île-de-France","ID_2":19,"NAME_2":"Yvelines","ID_3":89,"NAME_3":"Saint-Germain-en-Laye","ID_4":715,"NAME_4":"La Celle-Saint-Cloud","ID_5":5756,"NAME_5":"La Celle-Saint-Cloud","CCN_5":null,"CCA_5":null,"TYPE_5":"Chef-lieu canton","ENGTYPE_5":"Commune","Shape_Length":0.13498382692062408,"Shape_Area":0.0007196745059465904},"geometry":{"type":"MultiPolygon","coordinates":[[[[2.159867525100708,48.847721099853629],[2.150032281875667,48.846660614013672],[2.145872592926139,48.836902618408203],[2.120545625686759,48.836025238037166],[2.110636234283504,48.841087341308651],[2.11092042922985,48.849983215332031],[2.119793891906852,48.848270416259879],[2.122449874877987,48.850780487060661],[2.139863729476986,48.855907440185661],[2.144469022750854,48.861812591552848],[2.153764247894401,48.864406585693359],[2.150411605834961,48.858501434326172],[2.159867525100708,48.847721099853629]]]]}},{"type":"Feature","properties":{"fid":4722,"ID_0":79,"ISO":"FRA","NAME_0":"France","ID_1":4,"NAME_1":"Île-de-France","ID_2":13,"NAME_2":"Hauts-de-Seine","ID_3":51,"NAME_3":"Boulogne-Billancourt","ID_4":507,"NAME_4":"Chaville","ID_5":4722,"NAME_5":"Vaucresson","CCN_5":null,"CCA_5":null,"TYPE_5":"Commune simple","ENGTYPE_5":"Commune","Shape_Length":0.11045494594174084,"Shape_Area":0.00037342733185105235},"geometry":{"type":"MultiPolygon","coordinates":[[[[2.148475885391292,48.828491210937557],[2.145872592926139,48.836902618408203],[2.150032281875667,48.846660614013672],[2.159867525100708,48.847721099853629],[2.182619333267212,48.851566314697209],[2.179811716079769,48.845520019531364],[2.167349100112972,48.84089279174799],[2.166622877121029,48.837741851806697],[2.156419277191276,48.837657928466797],[2.151465654373169,48.821407318115348],[2.148475885391292,48.828491210937557]]]]}}]}`
+	geoJSONhole        = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"name":"donut"},"geometry":{"type":"Polygon","coordinates":[[[2.0,48.7],[2.4,48.7],[2.4,49.0],[2.0,49.0],[2.0,48.7]],[[2.1,48.8],[2.1,48.9],[2.3,48.9],[2.3,48.8],[2.1,48.8]]]}}]}`
+	geoJSONislands     = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"name":"islands"},"geometry":{"type":"MultiPolygon","coordinates":[[[[-3.0,47.0],[-2.9,47.0],[-2.9,47.1],[-3.0,47.1],[-3.0,47.0]]],[[[-2.5,47.0],[-2.4,47.0],[-2.4,47.1],[-2.5,47.1],[-2.5,47.0]]]]}}]}`
 	geoJSONbogusLoop   = `{"type":"FeatureCollection","crs":{"type":"name","properties":{"name":"urn:ogc:def:crs:OGC:1.3:CRS84"}},"features":[{"type":"Feature","properties":{"name":"Stuyvesant Town"},"geometry":{"type":"Polygon","coordinates":[[[-73.974378042082535,40.735081112182399],[-73.974377681392212,40.73508110966015],[-73.973959050297182,40.733421165538616],[-73.973943219249392,40.733403088863227],[-73.973907026951892,40.733349716608224],[-73.973866318655993,40.733310976086777],[-73.973844838548871,40.733265361113745],[-73.973865208024137,40.733246428039621],[-73.973857300365054,40.733216303638727],[-73.973841459626641,40.73321974036562],[-73.973849373812769,40.733232655106264],[-73.973831268466924,40.733245565109108],[-73.973809768465628,40.73324899937294],[-73.973783757834028,40.733227480705473],[-73.973802988474361,40.733211987539789],[-73.973783768671538,40.733199934826949],[-73.973764526494705,40.733212843387854],[-73.973727187077699,40.733219714350881],[-73.973689849825874,40.733218851106024],[-73.973676275760681,40.73320593388798],[-73.973692128598273,40.733174095747451],[-73.973737397623239,40.73314311937235],[-73.973818871718478,40.733099247654565],[-73.973872061740181,40.733094954806603],[-73.973868107762087,40.733065687195591],[-73.973658684424478,40.732244701586581],[-73.973514648369843,40.731680048528403],[-73.973430693696045,40.7313509277162],[-73.973413217308604,40.731282416428712],[-73.971963403012609,40.730000377217564],[-73.971955742642749,40.729988480733589],[-73.971479949072261,40.729249577698475],[-73.971427184435413,40.728485826387747],[-73.971555535149548,40.727703108598106],[-73.971569316470976,40.727693767198396],[-73.97157278760146,40.727645919767681],[-73.971589651499855,40.727640033693248],[-73.971618727069966,40.727650558185786],[-73.971651600755891,40.727643212534602],[-73.971685148665927,40.72740588663661],[-73.971536865927433,40.727392965100776],[-73.971520767896052,40.727386166239697],[-73.971512821812382,40.727374308581091],[-73.97149260058238,40.72737312335132],[-73.971490390928523,40.727350098110101],[-73.971629460631036,40.726760615951108],[-73.982552624994725,40.731374662598704],[-73.982022000000114,40.73201199999987],[-73.978527450968542,40.736854630838693],[-73.978526659827338,40.736854292908205],[-73.974907000000186,40.735312572323409],[-73.974648000000158,40.735081572323658],[-73.974377681392212,40.735079681983507],[-73.974378042082535,40.735081112182399]]]}}]}`
 )
 
@@ -70,6 +84,29 @@ var cpoints = []geostore.CPoint{
 	{Lat: 47.33148834860839, Lng: -3.114654101105884},
 }
 
+// belleIleFence returns belle ile region as a FenceStorage and its cover
+func belleIleFence() (*geostore.FenceStorage, *geostore.FenceCover) {
+	var points []*geostore.CPoint
+	// first point is last point
+	for i := range cpoints[:len(cpoints)-1] {
+		points = append(points, &cpoints[i])
+	}
+	fs := &geostore.FenceStorage{
+		Loops: []*geostore.LoopStorage{{Points: points}},
+		Data:  map[string]string{"name": "Belle Ile"},
+	}
+	fence := regionagogo.NewFenceFromStorage(fs)
+	rc := &s2.RegionCoverer{MinLevel: 1, MaxLevel: 24, MaxCells: 32}
+	cover := &geostore.FenceCover{}
+	for _, c := range rc.Covering(fence.Polygon) {
+		cover.Cellunion = append(cover.Cellunion, uint64(c))
+	}
+	for _, c := range rc.InteriorCovering(fence.Polygon) {
+		cover.Interior = append(cover.Interior, uint64(c))
+	}
+	return fs, cover
+}
+
 func createTempDB(t testing.TB) (string, func()) {
 	tmpfile, err := ioutil.TempFile("", "teststorage")
 	require.NoError(t, err)
@@ -81,6 +118,23 @@ func createTempDB(t testing.TB) (string, func()) {
 	}
 }
 
+// newOverlappingDB returns a database filled with the geoJSONoverlapping fences, named by their name property
+func newOverlappingDB(t testing.TB, opts ...GeoFenceBoltDBOption) (*GeoFenceBoltDB, func()) {
+	tmpfile, clean := createTempDB(t)
+
+	gs, err := NewGeoFenceBoltDB(tmpfile, opts...)
+	require.NoError(t, err)
+
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(geoJSONoverlapping), []string{"name"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+
+	return gs, func() {
+		gs.Close()
+		clean()
+	}
+}
+
 func TestStorage(t *testing.T) {
 	tmpfile, clean := createTempDB(t)
 	defer clean()
@@ -105,6 +159,14 @@ func TestStorage(t *testing.T) {
 }
 
 func BenchmarkCities(tb *testing.B) {
+	benchmarkCities(tb)
+}
+
+func BenchmarkCitiesRangeIndex(tb *testing.B) {
+	benchmarkCities(tb, WithRangeIndex(true))
+}
+
+func benchmarkCities(tb *testing.B, opts ...GeoFenceBoltDBOption) {
 	tmpfile, clean := createTempDB(tb)
 	defer clean()
 
@@ -114,13 +176,14 @@ func BenchmarkCities(tb *testing.B) {
 
 	r := bufio.NewReader(fi)
 
-	gs, err := NewGeoFenceBoltDB(tmpfile)
+	gs, err := NewGeoFenceBoltDB(tmpfile, opts...)
 	defer gs.Close()
 
 	i := regionagogo.NewGeoJSONImport(gs, r, []string{"iso_a2", "name"}, nil, nil)
 	err = i.Start()
 	require.NoError(tb, err)
 
+	tb.ResetTimer()
 	for i := 0; i < tb.N; i++ {
 		for _, city := range cities {
 			gs.StubbingQuery(city.c[0], city.c[1])
@@ -201,11 +264,11 @@ func TestOverlappingRegion(t *testing.T) {
 
 	region1 := gs.FenceByID(1)
 	require.NotNil(t, region1)
-	require.True(t, region1.Loop.ContainsPoint(p))
+	require.True(t, region1.Polygon.ContainsPoint(p))
 
 	region1 = gs.FenceByID(2)
 	require.NotNil(t, region1)
-	require.True(t, region1.Loop.ContainsPoint(p))
+	require.True(t, region1.Polygon.ContainsPoint(p))
 
 	fences, err := gs.StubbingQuery(48.85206549830757, 2.3064422607421875)
 	require.NoError(t, err)
@@ -235,7 +298,7 @@ func TestBadCover(t *testing.T) {
 
 	region2 := gs.FenceByID(2)
 	require.NotNil(t, region2)
-	require.True(t, region2.Loop.ContainsPoint(p))
+	require.True(t, region2.Polygon.ContainsPoint(p))
 
 	fences, err := gs.StubbingQuery(lat, lng)
 	require.NoError(t, err)
@@ -261,3 +324,1499 @@ func TestBogusLoop(t *testing.T) {
 	region1 := gs.FenceByID(0)
 	require.Nil(t, region1)
 }
+
+func TestPolygonHole(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	r := strings.NewReader(geoJSONhole)
+
+	i := regionagogo.NewGeoJSONImport(gs, r, []string{"name"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+
+	region := gs.FenceByID(1)
+	require.NotNil(t, region)
+	require.Equal(t, 2, region.Polygon.NumLoops())
+
+	// this point is inside the hole
+	fences, err := gs.StubbingQuery(48.85, 2.2)
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// this point is between the exterior loop and the hole
+	fences, err = gs.StubbingQuery(48.75, 2.05)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "donut", fences[0].Data["name"])
+
+	// the hole is part of the GeoJSON output
+	geo := region.ToGeoJSON()
+	require.Len(t, geo.Features, 1)
+	poly, ok := geo.Features[0].Geometry.(*geojson.Polygon)
+	require.True(t, ok)
+	require.Len(t, poly.Coordinates, 2)
+}
+
+func TestMultiPolygon(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	r := strings.NewReader(geoJSONislands)
+
+	i := regionagogo.NewGeoJSONImport(gs, r, []string{"name"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+
+	// both islands are stored as one fence
+	region := gs.FenceByID(1)
+	require.NotNil(t, region)
+	require.Equal(t, uint64(1), region.ID)
+	require.Equal(t, 2, region.Polygon.NumLoops())
+	require.Nil(t, gs.FenceByID(2))
+
+	for _, c := range [][]float64{{47.05, -2.95}, {47.05, -2.45}} {
+		fences, err := gs.StubbingQuery(c[0], c[1])
+		require.NoError(t, err)
+		require.Len(t, fences, 1)
+		require.Equal(t, uint64(1), fences[0].ID)
+	}
+
+	// between the islands
+	fences, err := gs.StubbingQuery(47.05, -2.7)
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	fences, err = gs.RectQuery(47.2, -2.3, 46.9, -3.1)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+
+	fences, err = gs.RadiusQuery(47.05, -2.7, 50000)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+
+	geo := region.ToGeoJSON()
+	require.Len(t, geo.Features, 1)
+	mp, ok := geo.Features[0].Geometry.(*geojson.MultiPolygon)
+	require.True(t, ok)
+	require.Len(t, mp.Coordinates, 2)
+}
+
+func TestFenceGeoJSON(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	// a donut and an island
+	feature := `{"type":"Feature","properties":{"name":"parts"},"geometry":{"type":"MultiPolygon","coordinates":[` +
+		`[[[2.0,48.7],[2.4,48.7],[2.4,49.0],[2.0,49.0],[2.0,48.7]],[[2.1,48.8],[2.1,48.9],[2.3,48.9],[2.3,48.8],[2.1,48.8]]],` +
+		`[[[3.0,48.7],[3.2,48.7],[3.2,48.9],[3.0,48.9],[3.0,48.7]]]]}}`
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(feature), []string{"name"}, nil, nil)
+	i.FeatureImport = true
+	err = i.Start()
+	require.NoError(t, err)
+
+	region := gs.FenceByID(1)
+	require.NotNil(t, region)
+	require.Equal(t, 3, region.Polygon.NumLoops())
+
+	geo := region.ToGeoJSON()
+	require.Len(t, geo.Features, 1)
+	mp, ok := geo.Features[0].Geometry.(*geojson.MultiPolygon)
+	require.True(t, ok)
+	require.Len(t, mp.Coordinates, 2)
+
+	// the hole stays with the donut
+	for _, p := range mp.Coordinates {
+		lng := float64(p[0][0][0])
+		if lng < 2.5 {
+			require.Len(t, p, 2)
+			for _, c := range p[1] {
+				require.InDelta(t, 2.2, float64(c[0]), 0.11)
+				require.InDelta(t, 48.85, float64(c[1]), 0.051)
+			}
+			continue
+		}
+		require.Len(t, p, 1)
+	}
+
+	// the GeoJSON output imports back to the same fence
+	b, err := json.Marshal(geo)
+	require.NoError(t, err)
+	tmpfile2, clean2 := createTempDB(t)
+	defer clean2()
+	gs2, err := NewGeoFenceBoltDB(tmpfile2)
+	require.NoError(t, err)
+	defer gs2.Close()
+	i = regionagogo.NewGeoJSONImport(gs2, bytes.NewReader(b), []string{"name"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		lat, lng float64
+		count    int
+	}{{48.75, 2.05, 1}, {48.85, 2.2, 0}, {48.8, 3.1, 1}, {48.8, 2.7, 0}} {
+		fences, err := gs2.StubbingQuery(c.lat, c.lng)
+		require.NoError(t, err)
+		require.Len(t, fences, c.count, "%v", c)
+	}
+}
+
+func TestDeleteFence(t *testing.T) {
+	gs, clean := newOverlappingDB(t, WithCachedEntries(10))
+	defer clean()
+
+	fences, err := gs.StubbingQuery(48.85206549830757, 2.3064422607421875)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "inner", fences[0].Data["name"])
+
+	err = gs.DeleteFence(2)
+	require.NoError(t, err)
+	require.Nil(t, gs.FenceByID(2))
+
+	// the next smaller fence is now returned
+	fences, err = gs.StubbingQuery(48.85206549830757, 2.3064422607421875)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "outter", fences[0].Data["name"])
+
+	fences, err = gs.StubbingQuery(48.85206549830757, 2.3064422607421875, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, fences, 2)
+
+	err = gs.DeleteFence(2)
+	require.Equal(t, regionagogo.ErrFenceNotFound, err)
+}
+
+func TestUpdateFence(t *testing.T) {
+	gs, clean := newOverlappingDB(t, WithCachedEntries(10))
+	defer clean()
+
+	// load fence 2 into the cache
+	require.Equal(t, "inner", gs.FenceByID(2).Data["name"])
+
+	// replace the inner fence by belle ile
+	fs, cover := belleIleFence()
+	err := gs.UpdateFence(2, fs, cover)
+	require.NoError(t, err)
+	require.Equal(t, "Belle Ile", gs.FenceByID(2).Data["name"])
+
+	fences, err := gs.StubbingQuery(48.85206549830757, 2.3064422607421875)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "outter", fences[0].Data["name"])
+
+	// Le Palais
+	fences, err = gs.StubbingQuery(47.339608, -3.164062)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, uint64(2), fences[0].ID)
+
+	err = gs.UpdateFence(42, fs, cover)
+	require.Equal(t, regionagogo.ErrFenceNotFound, err)
+}
+
+func TestFenceByKey(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	r := strings.NewReader(geoJSONoverlapping)
+
+	i := regionagogo.NewGeoJSONImport(gs, r, []string{"name"}, nil, nil)
+	i.KeyField = "name"
+	err = i.Start()
+	require.NoError(t, err)
+
+	fence := gs.FenceByKey("inner")
+	require.NotNil(t, fence)
+	require.Equal(t, uint64(2), fence.ID)
+	require.Equal(t, "inner", fence.Key)
+	require.Nil(t, gs.FenceByKey("unknown"))
+
+	// the GeoJSON feature is identified by the fence id and carries its key
+	b, err := json.Marshal(fence.ToGeoJSON())
+	require.NoError(t, err)
+	var fc struct {
+		Features []struct {
+			ID         uint64            `json:"id"`
+			Properties map[string]string `json:"properties"`
+		} `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(b, &fc))
+	require.Len(t, fc.Features, 1)
+	require.Equal(t, uint64(2), fc.Features[0].ID)
+	require.Equal(t, map[string]string{"name": "inner", "key": "inner"}, fc.Features[0].Properties)
+
+	// keys are unique
+	r = strings.NewReader(geoJSONoverlapping)
+	i = regionagogo.NewGeoJSONImport(gs, r, []string{"name"}, nil, nil)
+	i.KeyField = "name"
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrKeyExists, err)
+
+	// rename the key of fence 2
+	fs := &geostore.FenceStorage{
+		Loops: []*geostore.LoopStorage{{Points: []*geostore.CPoint{
+			{Lat: 48.83353759505566, Lng: 2.267303466796875},
+			{Lat: 48.83353759505566, Lng: 2.37030029296875},
+			{Lat: 48.87555444355432, Lng: 2.37030029296875},
+			{Lat: 48.87555444355432, Lng: 2.267303466796875},
+		}}},
+		Data: map[string]string{"name": "inner"},
+		Key:  "inner2",
+	}
+	cover := &geostore.FenceCover{Cellunion: []uint64{uint64(s2.CellIDFromLatLng(s2.LatLngFromDegrees(48.85, 2.3)).Parent(10))}}
+	err = gs.UpdateFence(2, fs, cover)
+	require.NoError(t, err)
+	require.Nil(t, gs.FenceByKey("inner"))
+	require.Equal(t, uint64(2), gs.FenceByKey("inner2").ID)
+
+	fs.Key = "outter"
+	err = gs.UpdateFence(2, fs, cover)
+	require.Equal(t, regionagogo.ErrKeyExists, err)
+
+	err = gs.DeleteFence(2)
+	require.NoError(t, err)
+	require.Nil(t, gs.FenceByKey("inner2"))
+}
+
+// TestConcurrentAccess is meant to be run with the race detector: go test -race
+func TestConcurrentAccess(t *testing.T) {
+	gs, clean := newOverlappingDB(t, WithCachedEntries(2))
+	defer clean()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				// FailNow can't be called outside of the test goroutine
+				fences, err := gs.StubbingQuery(48.85206549830757, 2.3064422607421875)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// "outter" and "bigoutter" are never modified
+				if len(fences) == 0 {
+					t.Error("expected a fence")
+					return
+				}
+
+				if _, err := gs.StubbingQuery(47.339608, -3.164062, regionagogo.WithMultipleFences(true)); err != nil {
+					t.Error(err)
+					return
+				}
+
+				if _, err := gs.RadiusQuery(48.85, 2.3, 10000); err != nil {
+					t.Error(err)
+					return
+				}
+
+				gs.FenceByID(2)
+			}
+		}()
+	}
+
+	fs, cover := belleIleFence()
+	for n := 0; n < 50; n++ {
+		err := gs.StoreFence(fs, cover)
+		require.NoError(t, err)
+
+		err = gs.UpdateFence(uint64(n+4), fs, cover)
+		require.NoError(t, err)
+
+		err = gs.DeleteFence(uint64(n + 4))
+		require.NoError(t, err)
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func TestRadiusQueryRelation(t *testing.T) {
+	gs, clean := newOverlappingDB(t)
+	defer clean()
+
+	// about 10km east of bigoutter, 12.5km east of outter
+	fences, err := gs.RadiusQuery(48.85, 2.6, 11000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+	require.InDelta(t, 10400, fences[0].Distance, 500)
+
+	fences, err = gs.RadiusQuery(48.85, 2.6, 5000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// the center is inside every fence
+	fences, err = gs.RadiusQuery(48.85, 2.33, 8000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	for _, f := range fences {
+		require.Equal(t, 0.0, f.Distance)
+	}
+
+	// only inner fits in the cap
+	fences, err = gs.RadiusQuery(48.85, 2.33, 8000, regionagogo.WithRelation(regionagogo.Within))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "inner", fences[0].Data["name"])
+
+	// cached fences are not modified by exact queries
+	require.Equal(t, 0.0, gs.FenceByID(3).Distance)
+
+	// approximate matches the fences whose cover touches the cap cover,
+	// inside the cap or not, without distance
+	fences, err = gs.RadiusQuery(48.85, 2.33, 8000)
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	for _, f := range fences {
+		require.Equal(t, 0.0, f.Distance)
+	}
+
+	// about 800m east of bigoutter, the covers touch
+	fences, err = gs.RadiusQuery(48.85, 2.47, 200, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+	fences, err = gs.RadiusQuery(48.85, 2.47, 200)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+
+	// about 5069km south of bigoutter, the cap radius is exact for large radiuses
+	fences, err = gs.RadiusQuery(3.25, 2.33, 5000000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+	fences, err = gs.RadiusQuery(3.25, 2.33, 5100000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+	require.InDelta(t, 5069000, fences[0].Distance, 1000)
+}
+
+func TestWithinCap(t *testing.T) {
+	// rectFence is a fence from its lower left and upper right corners
+	rectFence := func(lat1, lng1, lat2, lng2 float64) *regionagogo.Fence {
+		var points []s2.Point
+		for _, c := range [][2]float64{{lat1, lng1}, {lat1, lng2}, {lat2, lng2}, {lat2, lng1}} {
+			points = append(points, s2.PointFromLatLng(s2.LatLngFromDegrees(c[0], c[1])))
+		}
+		return &regionagogo.Fence{Polygon: s2.PolygonFromLoops([]*s2.Loop{s2.LoopFromPoints(points)})}
+	}
+	capOf := func(lat, lng, radius float64) s2.Cap {
+		return s2.CapFromCenterAngle(s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng)), s1.Angle(radius)*s1.Degree)
+	}
+
+	small := capOf(0, 0, 5)
+	require.True(t, rectFence(-1, -1, 1, 1).WithinCap(small))
+	require.False(t, rectFence(-10, -10, 10, 10).WithinCap(small))
+	require.False(t, rectFence(-1, 4, 1, 6).WithinCap(small))
+
+	// larger than a hemisphere, everywhere but 10 degrees around 0,0
+	large := capOf(0, 180, 170)
+	require.True(t, rectFence(-1, 89, 1, 91).WithinCap(large))
+	require.False(t, rectFence(-1, 4, 1, 6).WithinCap(large))
+	// every vertex is inside the cap but the fence is around its outside
+	require.False(t, rectFence(-20, -20, 20, 20).WithinCap(large))
+	// every vertex is inside the cap but an edge crosses its outside
+	require.False(t, rectFence(0, -20, 1, 20).WithinCap(large))
+
+	require.True(t, rectFence(-20, -20, 20, 20).WithinCap(s2.FullCap()))
+	require.False(t, rectFence(-1, -1, 1, 1).WithinCap(s2.EmptyCap()))
+}
+
+func TestRectQueryRelation(t *testing.T) {
+	gs, clean := newOverlappingDB(t)
+	defer clean()
+
+	// a small box inside inner
+	fences, err := gs.RectQuery(48.86, 2.32, 48.85, 2.30, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+
+	fences, err = gs.RectQuery(48.86, 2.32, 48.85, 2.30, regionagogo.WithRelation(regionagogo.Contains))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+
+	fences, err = gs.RectQuery(48.86, 2.32, 48.85, 2.30, regionagogo.WithRelation(regionagogo.Within))
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// a box crossing the east edge of bigoutter only
+	fences, err = gs.RectQuery(48.86, 2.5, 48.84, 2.44, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+
+	fences, err = gs.RectQuery(48.86, 2.5, 48.84, 2.44, regionagogo.WithRelation(regionagogo.Contains))
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// a box inside bigoutter only
+	fences, err = gs.RectQuery(48.9, 2.4, 48.8, 2.22, regionagogo.WithRelation(regionagogo.Contains))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+
+	// a box around inner
+	fences, err = gs.RectQuery(48.88, 2.38, 48.83, 2.26, regionagogo.WithRelation(regionagogo.Within))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "inner", fences[0].Data["name"])
+
+	// approximate matches the fences whose bounding rect is inside the box
+	fences, err = gs.RectQuery(48.88, 2.38, 48.83, 2.26)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "inner", fences[0].Data["name"])
+
+	// not the fences crossing the box
+	fences, err = gs.RectQuery(48.86, 2.5, 48.84, 2.44)
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+	fences, err = gs.RectQuery(48.86, 2.32, 48.85, 2.30)
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// the world viewport
+	fences, err = gs.RectQuery(90, 180, -90, -180)
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	fences, err = gs.RectQuery(90, 180, -90, -180, regionagogo.WithRelation(regionagogo.Within))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+
+	// the longitudes go east from bl to ur, boxes wider than 180° included
+	fences, err = gs.RectQuery(60, 100, 40, -100, regionagogo.WithRelation(regionagogo.Within))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	fences, err = gs.RectQuery(60, -100, 40, 100, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// a large box, the geodesic between its lower corners passes north of the fences
+	fences, err = gs.RectQuery(60, 65, 40, -60, regionagogo.WithRelation(regionagogo.Within))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	fences, err = gs.RectQuery(60, 65, 40, -60, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+
+	// boxes up to the pole, crossing the north edges of outter and bigoutter
+	for _, lngs := range [][2]float64{{-180, 180}, {0, 10}} {
+		fences, err = gs.RectQuery(90, lngs[1], 48.9, lngs[0], regionagogo.WithRelation(regionagogo.Intersects))
+		require.NoError(t, err)
+		require.Len(t, fences, 2)
+		fences, err = gs.RectQuery(90, lngs[1], 48.9, lngs[0], regionagogo.WithRelation(regionagogo.Within))
+		require.NoError(t, err)
+		require.Len(t, fences, 0)
+	}
+}
+
+func TestNearestQuery(t *testing.T) {
+	gs, clean := newOverlappingDB(t)
+	defer clean()
+
+	// about 10km east of bigoutter, 12.5km east of outter
+	fences, err := gs.NearestQuery(48.85, 2.6, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, fences, 2)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+	require.InDelta(t, 10400, fences[0].Distance, 500)
+	require.Equal(t, "outter", fences[1].Data["name"])
+	require.InDelta(t, 12500, fences[1].Distance, 500)
+
+	fences, err = gs.NearestQuery(48.85, 2.6, 2, 5000)
+	require.NoError(t, err)
+	require.Len(t, fences, 0)
+
+	// inside every fence
+	fences, err = gs.NearestQuery(48.85, 2.33, 5, 0)
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	for _, f := range fences {
+		require.Equal(t, 0.0, f.Distance)
+	}
+
+	_, err = gs.NearestQuery(48.85, 2.33, 0, 0)
+	require.Error(t, err)
+}
+
+func TestBoundaryDistance(t *testing.T) {
+	gs, clean := newOverlappingDB(t)
+	defer clean()
+
+	fences, err := gs.StubbingQuery(48.85, 2.33)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Nil(t, fences[0].BoundaryPoint)
+
+	// about 1.8km north of the south edge of inner
+	fences, err = gs.StubbingQuery(48.85, 2.33, regionagogo.WithBoundaryDistance(true))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "inner", fences[0].Data["name"])
+	require.InDelta(t, 1830, fences[0].BoundaryDistance, 100)
+	require.NotNil(t, fences[0].BoundaryPoint)
+	require.InDelta(t, 48.8335, fences[0].BoundaryPoint.Lat, 0.001)
+	require.InDelta(t, 2.33, fences[0].BoundaryPoint.Lng, 0.001)
+
+	fences, err = gs.StubbingQuery(48.85, 2.33, regionagogo.WithBoundaryDistance(true), regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+	for _, f := range fences {
+		require.NotNil(t, f.BoundaryPoint)
+	}
+
+	// cached fences are not modified
+	require.Nil(t, gs.FenceByID(2).BoundaryPoint)
+}
+
+func TestBatchStubbingQuery(t *testing.T) {
+	gs, clean := newOverlappingDB(t)
+	defer clean()
+
+	points := []regionagogo.LatLng{
+		{Lat: 48.85, Lng: 2.33},  // inner
+		{Lat: 48.85, Lng: 2.6},   // outside
+		{Lat: 48.89, Lng: 2.42},  // outter
+		{Lat: 48.85, Lng: 2.331}, // inner, same cell as the first point
+		{Lat: 48.79, Lng: 2.21},  // bigoutter
+	}
+
+	regions, err := gs.BatchStubbingQuery(points)
+	require.NoError(t, err)
+	require.Len(t, regions, len(points))
+
+	// results are in the same order as points and match single queries
+	for i, p := range points {
+		fences, err := gs.StubbingQuery(p.Lat, p.Lng)
+		require.NoError(t, err)
+		require.Equal(t, fences, regions[i])
+	}
+	require.Equal(t, "inner", regions[0][0].Data["name"])
+	require.Len(t, regions[1], 0)
+	require.Equal(t, "outter", regions[2][0].Data["name"])
+	require.Equal(t, "bigoutter", regions[4][0].Data["name"])
+
+	regions, err = gs.BatchStubbingQuery(points[:1], regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, regions[0], 3)
+}
+
+func TestPrepareFeature(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	i := regionagogo.NewGeoJSONImport(gs, nil, []string{"name"}, nil, nil)
+
+	var fc geojson.FeatureCollection
+	err = json.Unmarshal([]byte(geoJSONhole), &fc)
+	require.NoError(t, err)
+
+	fs, cover, err := i.PrepareFeature(fc.Features[0])
+	require.NoError(t, err)
+	require.Len(t, fs.Loops, 2)
+	require.Equal(t, "donut", fs.Data["name"])
+
+	// queryable as soon as stored
+	err = gs.StoreFence(fs, cover)
+	require.NoError(t, err)
+	fences, err := gs.StubbingQuery(48.75, 2.05)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+
+	// a ring needs at least 4 positions
+	var f geojson.Feature
+	err = json.Unmarshal([]byte(`{"type":"Feature","properties":{"name":"line"},"geometry":{"type":"Polygon","coordinates":[[[2.0,48.7],[2.4,48.7],[2.0,48.7]]]}}`), &f)
+	require.NoError(t, err)
+	_, _, err = i.PrepareFeature(&f)
+	require.Equal(t, regionagogo.ErrInvalidFence, err)
+}
+
+func TestPersistedIndex(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+
+	for _, geo := range []string{geoJSONoverlapping, geoJSONhole} {
+		i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(geo), []string{"name"}, nil, nil)
+		err = i.Start()
+		require.NoError(t, err)
+	}
+
+	points := []regionagogo.LatLng{
+		{Lat: 48.85, Lng: 2.33},
+		{Lat: 48.85, Lng: 2.2},
+		{Lat: 48.75, Lng: 2.05},
+		{Lat: 48.85, Lng: 2.6},
+	}
+	expected, err := gs.BatchStubbingQuery(points, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	expectedRect, err := gs.RectQuery(48.9, 2.5, 48.8, 2.2, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+
+	err = gs.BuildIndex()
+	require.NoError(t, err)
+	err = gs.Close()
+	require.NoError(t, err)
+
+	gs, err = NewGeoFenceBoltDB(tmpfile, WithReadOnly(true))
+	require.NoError(t, err)
+	require.NotNil(t, gs.ranges)
+
+	// the persisted index answers like the tree
+	for i, p := range points {
+		fences, err := gs.StubbingQuery(p.Lat, p.Lng, regionagogo.WithMultipleFences(true))
+		require.NoError(t, err)
+		require.Equal(t, len(expected[i]), len(fences))
+		for j := range fences {
+			require.Equal(t, expected[i][j].ID, fences[j].ID)
+		}
+	}
+	regions, err := gs.BatchStubbingQuery(points, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Equal(t, expected, regions)
+	fences, err := gs.RectQuery(48.9, 2.5, 48.8, 2.2, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, len(expectedRect))
+	err = gs.Close()
+	require.NoError(t, err)
+
+	// a writable db uses the index until its first write, the write removes the outdated index
+	gs, err = NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	require.NotNil(t, gs.ranges)
+	err = gs.DeleteFence(1)
+	require.NoError(t, err)
+	require.Nil(t, gs.ranges)
+	fences, err = gs.StubbingQuery(48.85, 2.33, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, fences, len(expected[0])-1)
+	err = gs.Close()
+	require.NoError(t, err)
+
+	gs, err = NewGeoFenceBoltDB(tmpfile, WithReadOnly(true))
+	require.NoError(t, err)
+	defer gs.Close()
+	require.Nil(t, gs.ranges)
+}
+
+func TestBuildCellRanges(t *testing.T) {
+	parent := s2.CellIDFromLatLng(s2.LatLngFromDegrees(48.85, 2.33)).Parent(10)
+	child := parent.Children()[1]
+
+	data := buildCellRanges([]cellEntry{{cell: parent, loopID: 1}, {cell: child, loopID: 2}})
+	cr, err := newCellRanges(data)
+	require.NoError(t, err)
+
+	// before the child, the child, after the child
+	require.Equal(t, 3, cr.n)
+	ranges := cr.overlapping(parent)
+	require.Len(t, ranges, 3)
+	require.Equal(t, []uint64{1}, ranges[0].loopIDs)
+	require.Equal(t, child.RangeMin(), ranges[1].min)
+	require.Equal(t, child.RangeMax(), ranges[1].max)
+	require.Equal(t, []uint64{1, 2}, ranges[1].loopIDs)
+	require.Equal(t, []uint64{1}, ranges[2].loopIDs)
+
+	ranges = cr.overlapping(child.ChildBegin())
+	require.Len(t, ranges, 1)
+	require.Equal(t, []uint64{1, 2}, ranges[0].loopIDs)
+
+	ranges = cr.overlapping(parent.Next())
+	require.Len(t, ranges, 0)
+
+	_, err = newCellRanges(data[:10])
+	require.Error(t, err)
+
+	// a truncated index, loopIDs missing
+	_, err = newCellRanges(data[:len(data)-8])
+	require.Equal(t, errInvalidRanges, err)
+
+	// a corrupt loopIDs offset
+	corrupt := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(corrupt[rangesHeaderLen+16:], 1<<20)
+	_, err = newCellRanges(corrupt)
+	require.Equal(t, errInvalidRanges, err)
+
+	// a corrupt ranges count
+	binary.BigEndian.PutUint64(corrupt[8:], 1<<62)
+	_, err = newCellRanges(corrupt)
+	require.Equal(t, errInvalidRanges, err)
+}
+
+func TestRangeIndex(t *testing.T) {
+	parent := s2.CellIDFromLatLng(s2.LatLngFromDegrees(48.85, 2.33)).Parent(10)
+	child := parent.Children()[1]
+
+	ri := newRangeIndex()
+	ri.add(&geostore.FenceCover{Cellunion: []uint64{uint64(parent)}}, 1)
+	ri.add(&geostore.FenceCover{Cellunion: []uint64{uint64(child)}}, 2)
+	require.Len(t, ri.ranges, 3)
+	require.Equal(t, []uint64{1, 2}, ri.ranges[1].loopIDs)
+
+	// same as a bulk load
+	loaded := newRangeIndex()
+	loaded.load([]cellEntry{{cell: child, loopID: 2}, {cell: parent, loopID: 1}})
+	require.Equal(t, loaded.ranges, ri.ranges)
+
+	ranges := ri.overlapping(child.ChildBegin())
+	require.Len(t, ranges, 1)
+	require.Equal(t, []uint64{1, 2}, ranges[0].loopIDs)
+
+	// removing the child merges back the parent ranges
+	ri.remove(&geostore.FenceCover{Cellunion: []uint64{uint64(child)}}, 2)
+	require.Len(t, ri.ranges, 1)
+	require.Equal(t, parent.RangeMin(), ri.ranges[0].min)
+	require.Equal(t, parent.RangeMax(), ri.ranges[0].max)
+
+	ri.add(&geostore.FenceCover{Cellunion: []uint64{uint64(parent.Next())}}, 1)
+	require.Len(t, ri.ranges, 2)
+	require.Equal(t, []uint64{1}, ri.overlapping(parent.Next().ChildBegin())[0].loopIDs)
+
+	ri.remove(&geostore.FenceCover{Cellunion: []uint64{uint64(parent), uint64(parent.Next())}}, 1)
+	require.Len(t, ri.ranges, 0)
+}
+
+func TestRangeIndexQueries(t *testing.T) {
+	points := []regionagogo.LatLng{
+		{Lat: 48.85206549830757, Lng: 2.3064422607421875},
+		{Lat: 48.85, Lng: 2.2},
+		{Lat: 48.75, Lng: 2.05},
+		{Lat: 48.85, Lng: 2.6},
+	}
+
+	var expected [][]regionagogo.Fences
+	for _, opt := range []GeoFenceBoltDBOption{WithRangeIndex(false), WithRangeIndex(true)} {
+		tmpfile, clean := createTempDB(t)
+		defer clean()
+
+		gs, err := NewGeoFenceBoltDB(tmpfile, opt)
+		require.NoError(t, err)
+		defer gs.Close()
+
+		for _, geo := range []string{geoJSONoverlapping, geoJSONhole} {
+			i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(geo), []string{"name"}, nil, nil)
+			err = i.Start()
+			require.NoError(t, err)
+		}
+
+		var res []regionagogo.Fences
+		regions, err := gs.BatchStubbingQuery(points, regionagogo.WithMultipleFences(true))
+		require.NoError(t, err)
+		res = append(res, regions...)
+
+		// the index is updated by the writes
+		err = gs.DeleteFence(2)
+		require.NoError(t, err)
+		for _, p := range points {
+			fences, err := gs.StubbingQuery(p.Lat, p.Lng, regionagogo.WithMultipleFences(true))
+			require.NoError(t, err)
+			res = append(res, fences)
+		}
+
+		expected = append(expected, res)
+	}
+
+	require.Equal(t, len(expected[0]), len(expected[1]))
+	for i := range expected[0] {
+		require.Equal(t, len(expected[0][i]), len(expected[1][i]))
+		for j := range expected[0][i] {
+			require.Equal(t, expected[0][i][j].ID, expected[1][i][j].ID)
+		}
+	}
+}
+
+func TestInteriorCovering(t *testing.T) {
+	var fc geojson.FeatureCollection
+	err := json.Unmarshal([]byte(geoJSONoverlapping), &fc)
+	require.NoError(t, err)
+
+	i := regionagogo.NewGeoJSONImport(nil, nil, []string{"name"}, nil, nil)
+	_, cover, err := i.PrepareFeature(fc.Features[0])
+	require.NoError(t, err)
+	require.NotEmpty(t, cover.Cellunion)
+	require.NotEmpty(t, cover.Interior)
+
+	for _, opt := range []GeoFenceBoltDBOption{WithRangeIndex(false), WithRangeIndex(true)} {
+		tmpfile, clean := createTempDB(t)
+		defer clean()
+
+		gs, err := NewGeoFenceBoltDB(tmpfile, opt)
+		require.NoError(t, err)
+		defer gs.Close()
+
+		// an interior cell far from the fence shows the point in polygon test is skipped
+		paris := s2.CellIDFromLatLng(s2.LatLngFromDegrees(48.85, 2.33)).Parent(12)
+		fs, cover := belleIleFence()
+		cover.Cellunion = append(cover.Cellunion, uint64(paris))
+		cover.Interior = append(cover.Interior, uint64(paris))
+		err = gs.StoreFence(fs, cover)
+		require.NoError(t, err)
+
+		fences, err := gs.StubbingQuery(48.85, 2.33)
+		require.NoError(t, err)
+		require.Len(t, fences, 1)
+		require.Equal(t, "Belle Ile", fences[0].Data["name"])
+
+		regions, err := gs.BatchStubbingQuery([]regionagogo.LatLng{{Lat: 48.85, Lng: 2.33}, {Lat: 47.339608, Lng: -3.164062}})
+		require.NoError(t, err)
+		require.Len(t, regions[0], 1)
+		require.Len(t, regions[1], 1)
+
+		// the interior cells are removed with the fence
+		err = gs.DeleteFence(1)
+		require.NoError(t, err)
+		fences, err = gs.StubbingQuery(48.85, 2.33)
+		require.NoError(t, err)
+		require.Len(t, fences, 0)
+	}
+}
+
+func TestCovererSettings(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+
+	cs, err := gs.CovererSettings()
+	require.NoError(t, err)
+	require.Equal(t, regionagogo.DefaultCovererSettings, cs)
+
+	coverer := regionagogo.CovererSettings{MinLevel: 4, MaxLevel: 16, LevelMod: 2, MaxCells: 4}
+	require.NoError(t, coverer.Validate())
+	require.Equal(t, regionagogo.ErrInvalidCoverer, regionagogo.CovererSettings{MinLevel: 10, MaxLevel: 8, LevelMod: 1, MaxCells: 4}.Validate())
+
+	// set before the import, like ragogenfromjson does
+	err = gs.SetCovererSettings(coverer)
+	require.NoError(t, err)
+
+	var report bytes.Buffer
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(geoJSONoverlapping), []string{"name"}, nil, nil)
+	i.Coverer = coverer
+	i.CoverReport = &report
+	err = i.Start()
+	require.NoError(t, err)
+
+	// a header and one line per fence
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	require.Len(t, lines, 4)
+	for _, line := range lines[1:] {
+		require.Len(t, strings.Split(line, "\t"), 8)
+	}
+
+	err = gs.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(gs.coverBucket).ForEach(func(k, v []byte) error {
+			var fc geostore.FenceCover
+			require.NoError(t, proto.Unmarshal(v, &fc))
+			stats := regionagogo.NewCoverStats(fc.Cellunion)
+			require.True(t, stats.Cells <= coverer.MaxCells)
+			require.True(t, stats.MinLevel >= coverer.MinLevel)
+			require.True(t, stats.MaxLevel <= coverer.MaxLevel)
+			return nil
+		})
+	})
+	require.NoError(t, err)
+
+	// another import must use the same settings
+	err = gs.SetCovererSettings(coverer)
+	require.NoError(t, err)
+	err = gs.SetCovererSettings(regionagogo.DefaultCovererSettings)
+	require.Equal(t, ErrCovererMismatch, err)
+	err = gs.Close()
+	require.NoError(t, err)
+
+	gs, err = NewGeoFenceBoltDB(tmpfile, WithReadOnly(true))
+	require.NoError(t, err)
+	defer gs.Close()
+
+	cs, err = gs.CovererSettings()
+	require.NoError(t, err)
+	require.Equal(t, coverer, cs)
+	require.Equal(t, ErrReadOnly, gs.SetCovererSettings(coverer))
+
+	// the queries covers don't depend on the fences covers levels
+	fences, err := gs.RadiusQuery(48.85, 2.6, 11000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+
+	fences, err = gs.RadiusQuery(48.85, 2.33, 8000, regionagogo.WithRelation(regionagogo.Intersects))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+
+	fences, err = gs.NearestQuery(48.85, 2.6, 2, 0)
+	require.NoError(t, err)
+	require.Len(t, fences, 2)
+	require.Equal(t, "bigoutter", fences[0].Data["name"])
+	require.Equal(t, "outter", fences[1].Data["name"])
+}
+
+func TestMetadata(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+
+	m, err := gs.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, FormatVersion, m.FormatVersion)
+	require.Equal(t, 0, m.Fences)
+	require.Equal(t, regionagogo.DefaultCovererSettings, m.Coverer)
+
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(geoJSONoverlapping), []string{"name"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+	err = gs.RecordImport("overlapping.geojson", []string{"name"}, "")
+	require.NoError(t, err)
+	err = gs.RecordImport("hole.geojson", []string{"name"}, "")
+	require.NoError(t, err)
+	err = gs.Close()
+	require.NoError(t, err)
+
+	gs, err = NewGeoFenceBoltDB(tmpfile, WithReadOnly(true))
+	require.NoError(t, err)
+	m, err = gs.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, 3, m.Fences)
+	require.Equal(t, []string{"overlapping.geojson", "hole.geojson"}, m.Sources)
+	require.Equal(t, []string{"name"}, m.ImportFields)
+	require.False(t, m.BuildDate.IsZero())
+	err = gs.Close()
+	require.NoError(t, err)
+
+	// a database written by a newer version is refused
+	setVersion := func(version []byte) {
+		db, err := bolt.Open(tmpfile, 0600, nil)
+		require.NoError(t, err)
+		err = db.Update(func(tx *bolt.Tx) error {
+			if version == nil {
+				if err := tx.Bucket([]byte(defaultMetaBucket)).Delete(countKey); err != nil {
+					return err
+				}
+				return tx.Bucket([]byte(defaultMetaBucket)).Delete(versionKey)
+			}
+			return tx.Bucket([]byte(defaultMetaBucket)).Put(versionKey, version)
+		})
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	}
+	setVersion(itob(FormatVersion + 1))
+	_, err = NewGeoFenceBoltDB(tmpfile, WithReadOnly(true))
+	require.Equal(t, ErrUnsupportedFormat, err)
+
+	// a database prior to the meta bucket is readable and migrated when writable
+	setVersion(nil)
+	gs, err = NewGeoFenceBoltDB(tmpfile, WithReadOnly(true))
+	require.NoError(t, err)
+	m, err = gs.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, 0, m.FormatVersion)
+	require.Equal(t, 3, m.Fences)
+	require.NoError(t, gs.Close())
+
+	gs, err = NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+	m, err = gs.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, FormatVersion, m.FormatVersion)
+	require.Equal(t, 3, m.Fences)
+
+	// the fence count is kept by the writes
+	require.NoError(t, gs.DeleteFence(1))
+	m, err = gs.Metadata()
+	require.NoError(t, err)
+	require.Equal(t, 2, m.Fences)
+}
+
+func TestStreamingImport(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	// members after the features are skipped
+	geo := strings.TrimSuffix(geoJSONoverlapping, "}") + `,"bbox":[2.2,48.7,2.5,48.9]}`
+
+	var progress []int
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(geo), []string{"name"}, nil, nil)
+	i.BatchSize = 2
+	i.Progress = func(fences int, bytesRead int64) {
+		progress = append(progress, fences)
+		require.True(t, bytesRead > 0)
+	}
+	err = i.Start()
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3}, progress)
+
+	fences, err := gs.StubbingQuery(48.85206549830757, 2.3064422607421875)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "inner", fences[0].Data["name"])
+
+	// a single feature
+	feature := `{"properties":{"name":"donut"},"type":"Feature","geometry":{"type":"Polygon","coordinates":[[[2.0,48.7],[2.4,48.7],[2.4,49.0],[2.0,49.0],[2.0,48.7]]]}}`
+	i = regionagogo.NewGeoJSONImport(gs, strings.NewReader(feature), []string{"name"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+	require.NotNil(t, gs.FenceByID(4))
+
+	i = regionagogo.NewGeoJSONImport(gs, strings.NewReader(`[1, 2]`), []string{"name"}, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrInvalidGeoJSON, err)
+
+	// a batch is stored entirely or not at all
+	i = regionagogo.NewGeoJSONImport(gs, strings.NewReader(geoJSONoverlapping), []string{"name"}, nil, nil)
+	i.KeyField = "name"
+	err = i.Start()
+	require.NoError(t, err)
+
+	fss := make([]*geostore.FenceStorage, 2)
+	fcs := make([]*geostore.FenceCover, 2)
+	for j, key := range []string{"new", "inner"} {
+		fss[j], fcs[j] = belleIleFence()
+		fss[j].Key = key
+	}
+	err = gs.StoreFences(fss, fcs)
+	require.Equal(t, regionagogo.ErrKeyExists, err)
+	require.Nil(t, gs.FenceByKey("new"))
+}
+
+func TestGeoJSONSeqImport(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	feature := `{"type":"Feature","properties":{"name":"%s"},"geometry":{"type":"Polygon","coordinates":[[[%[2]f,48.7],[%[3]f,48.7],[%[3]f,49.0],[%[2]f,49.0],[%[2]f,48.7]]]}}`
+	west := fmt.Sprintf(feature, "west", 2.0, 2.3)
+	east := fmt.Sprintf(feature, "east", 2.3, 2.6)
+
+	// RFC 8142 records are prefixed by RS
+	seq := "\x1e" + west + "\n\x1e" + east + "\n"
+	i := regionagogo.NewGeoJSONImport(gs, strings.NewReader(seq), []string{"name"}, nil, nil)
+	i.Format = regionagogo.FormatGeoJSONSeq
+	err = i.Start()
+	require.NoError(t, err)
+
+	fences, err := gs.StubbingQuery(48.85, 2.1)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "west", fences[0].Data["name"])
+
+	fences, err = gs.StubbingQuery(48.85, 2.5)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+	require.Equal(t, "east", fences[0].Data["name"])
+
+	// NDJSON with blank lines and a missing final newline
+	ndjson := west + "\n\n" + east + "\r\n\n" + west
+	i = regionagogo.NewGeoJSONImport(gs, strings.NewReader(ndjson), []string{"name"}, nil, nil)
+	i.Format = regionagogo.FormatGeoJSONSeq
+	err = i.Start()
+	require.NoError(t, err)
+
+	fences, err = gs.StubbingQuery(48.85, 2.1, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, fences, 3)
+
+	i = regionagogo.NewGeoJSONImport(gs, strings.NewReader(west+"\n{\"type\":"), []string{"name"}, nil, nil)
+	i.Format = regionagogo.FormatGeoJSONSeq
+	err = i.Start()
+	require.Error(t, err)
+}
+
+// square returns a closed clockwise ring, counter clockwise if ccw for a shapefile hole
+func square(minLng, minLat, maxLng, maxLat float64, ccw bool) [][2]float64 {
+	if ccw {
+		return [][2]float64{{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat}}
+	}
+	return [][2]float64{{minLng, minLat}, {minLng, maxLat}, {maxLng, maxLat}, {maxLng, minLat}, {minLng, minLat}}
+}
+
+// testShapefile returns the .shp and .dbf of polygon shapes made of rings, with their NAME attribute
+// the records of deleted shapes are marked deleted in the dbf
+func testShapefile(shapes [][][][2]float64, names []string, deleted []bool) ([]byte, []byte) {
+	var records bytes.Buffer
+	for n, rings := range shapes {
+		var numPoints int
+		for _, ring := range rings {
+			numPoints += len(ring)
+		}
+
+		content := make([]byte, 44+4*len(rings)+16*numPoints)
+		binary.LittleEndian.PutUint32(content, 5)
+		binary.LittleEndian.PutUint32(content[36:], uint32(len(rings)))
+		binary.LittleEndian.PutUint32(content[40:], uint32(numPoints))
+		var p int
+		for j, ring := range rings {
+			binary.LittleEndian.PutUint32(content[44+4*j:], uint32(p))
+			for _, c := range ring {
+				pt := content[44+4*len(rings)+16*p:]
+				binary.LittleEndian.PutUint64(pt, math.Float64bits(c[0]))
+				binary.LittleEndian.PutUint64(pt[8:], math.Float64bits(c[1]))
+				p++
+			}
+		}
+
+		var h [8]byte
+		binary.BigEndian.PutUint32(h[:], uint32(n+1))
+		binary.BigEndian.PutUint32(h[4:], uint32(len(content)/2))
+		records.Write(h[:])
+		records.Write(content)
+	}
+
+	shp := make([]byte, 100, 100+records.Len())
+	binary.BigEndian.PutUint32(shp, 9994)
+	binary.BigEndian.PutUint32(shp[24:], uint32((100+records.Len())/2))
+	binary.LittleEndian.PutUint32(shp[28:], 1000)
+	binary.LittleEndian.PutUint32(shp[32:], 5)
+	shp = append(shp, records.Bytes()...)
+
+	const nameLen = 20
+	dbf := make([]byte, 65)
+	dbf[0] = 3
+	binary.LittleEndian.PutUint32(dbf[4:], uint32(len(names)))
+	binary.LittleEndian.PutUint16(dbf[8:], 65)
+	binary.LittleEndian.PutUint16(dbf[10:], 1+nameLen)
+	copy(dbf[32:], "NAME")
+	dbf[43] = 'C'
+	dbf[48] = nameLen
+	dbf[64] = 0x0d
+	for n, name := range names {
+		flag := byte(' ')
+		if deleted[n] {
+			flag = '*'
+		}
+		dbf = append(dbf, flag)
+		dbf = append(dbf, fmt.Sprintf("%-20s", name)...)
+	}
+	dbf = append(dbf, 0x1a)
+
+	return shp, dbf
+}
+
+func TestShapefileImport(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	shapes := [][][][2]float64{
+		{square(2.0, 48.7, 2.6, 49.0, false), square(2.2, 48.8, 2.4, 48.9, true)},
+		// the hole of the first part comes last
+		{square(10, 45, 11, 46, false), square(12, 45, 13, 46, false), square(10.4, 45.4, 10.6, 45.6, true)},
+		{square(20, 45, 21, 46, false)},
+	}
+	// Latin-1 encoded name
+	names := []string{"Paris", "Orl\xe9ans", "gone"}
+	shp, dbf := testShapefile(shapes, names, []bool{false, false, true})
+
+	i := regionagogo.NewShapefileImport(gs, bytes.NewReader(shp), bytes.NewReader(dbf), []string{"NAME"}, nil, map[string]string{"NAME": "name"})
+	i.KeyField = "NAME"
+	err = i.Start()
+	require.NoError(t, err)
+
+	tests := []struct {
+		lat, lng float64
+		name     string
+	}{
+		{48.75, 2.1, "Paris"},
+		{48.85, 2.3, ""},
+		{45.5, 10.2, "Orléans"},
+		{45.5, 10.5, ""},
+		{45.5, 12.5, "Orléans"},
+		{45.5, 20.5, ""},
+	}
+	for _, test := range tests {
+		fences, err := gs.StubbingQuery(test.lat, test.lng)
+		require.NoError(t, err)
+		if test.name == "" {
+			require.Len(t, fences, 0, "%v", test)
+			continue
+		}
+		require.Len(t, fences, 1, "%v", test)
+		require.Equal(t, test.name, fences[0].Data["name"])
+		require.Equal(t, test.name, fences[0].Key)
+	}
+
+	// shapes without attributes
+	i = regionagogo.NewShapefileImport(gs, bytes.NewReader(shp), nil, nil, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+	fences, err := gs.StubbingQuery(45.5, 20.5)
+	require.NoError(t, err)
+	require.Len(t, fences, 1)
+
+	i = regionagogo.NewShapefileImport(gs, strings.NewReader(geoJSONoverlapping), nil, nil, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrInvalidShapefile, err)
+
+	// Lambert 93 coordinates, a projected coordinate system
+	projected := [][][][2]float64{{square(652000, 6861000, 653000, 6862000, false)}}
+	shp, dbf = testShapefile(projected, []string{"Paris"}, []bool{false})
+	i = regionagogo.NewShapefileImport(gs, bytes.NewReader(shp), bytes.NewReader(dbf), []string{"NAME"}, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrProjectedShapefile, err)
+
+	// refused from the header bounding box
+	binary.LittleEndian.PutUint64(shp[36:], math.Float64bits(652000))
+	binary.LittleEndian.PutUint64(shp[44:], math.Float64bits(6861000))
+	i = regionagogo.NewShapefileImport(gs, bytes.NewReader(shp[:100]), nil, nil, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrProjectedShapefile, err)
+}
+
+const testKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+  <Folder>
+    <name>zones</name>
+    <Placemark>
+      <name>Paris</name>
+      <ExtendedData>
+        <Data name="zone"><value>A1</value></Data>
+      </ExtendedData>
+      <Polygon>
+        <outerBoundaryIs><LinearRing><coordinates>
+          2.0,48.7,0 2.6,48.7,0 2.6,49.0,0 2.0,49.0,0 2.0,48.7,0
+        </coordinates></LinearRing></outerBoundaryIs>
+        <innerBoundaryIs><LinearRing><coordinates>2.2,48.8 2.4,48.8 2.4,48.9 2.2,48.9</coordinates></LinearRing></innerBoundaryIs>
+      </Polygon>
+    </Placemark>
+  </Folder>
+  <Placemark>
+    <name>Islands</name>
+    <ExtendedData>
+      <SchemaData schemaUrl="#zones"><SimpleData name="zone">B2</SimpleData></SchemaData>
+    </ExtendedData>
+    <MultiGeometry>
+      <Point><coordinates>10.5,45.5</coordinates></Point>
+      <Polygon><outerBoundaryIs><LinearRing><coordinates>10,45 11,45 11,46 10,46 10,45</coordinates></LinearRing></outerBoundaryIs></Polygon>
+      <MultiGeometry>
+        <Polygon><outerBoundaryIs><LinearRing><coordinates>12,45 12,46 13,46 13,45 12,45</coordinates></LinearRing></outerBoundaryIs></Polygon>
+      </MultiGeometry>
+    </MultiGeometry>
+  </Placemark>
+  <Placemark>
+    <name>Depot</name>
+    <Point><coordinates>20.5,45.5</coordinates></Point>
+  </Placemark>
+</Document>
+</kml>`
+
+func TestKMLImport(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	i := regionagogo.NewKMLImport(gs, strings.NewReader(testKML), []string{"name", "zone"}, nil, nil)
+	i.KeyField = "zone"
+	err = i.Start()
+	require.NoError(t, err)
+
+	tests := []struct {
+		lat, lng float64
+		zone     string
+	}{
+		{48.75, 2.1, "A1"},
+		{48.85, 2.3, ""},
+		{45.5, 10.5, "B2"},
+		{45.5, 12.5, "B2"},
+		{45.5, 20.5, ""},
+	}
+	for _, test := range tests {
+		fences, err := gs.StubbingQuery(test.lat, test.lng)
+		require.NoError(t, err)
+		if test.zone == "" {
+			require.Len(t, fences, 0, "%v", test)
+			continue
+		}
+		require.Len(t, fences, 1, "%v", test)
+		require.Equal(t, test.zone, fences[0].Key)
+		require.Equal(t, test.zone, fences[0].Data["zone"])
+	}
+	require.Equal(t, "Paris", gs.FenceByKey("A1").Data["name"])
+
+	// the same document in a KMZ archive
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("files/ignored.kml")
+	require.NoError(t, err)
+	w.Write([]byte(`<kml></kml>`))
+	w, err = zw.Create("doc.kml")
+	require.NoError(t, err)
+	w.Write([]byte(strings.Replace(testKML, "A1", "C3", -1)))
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	doc, err := regionagogo.KMZDocument(zr)
+	require.NoError(t, err)
+	require.Equal(t, "doc.kml", doc.Name)
+	rc, err := doc.Open()
+	require.NoError(t, err)
+	defer rc.Close()
+
+	i = regionagogo.NewKMLImport(gs, rc, []string{"name", "zone"}, nil, nil)
+	err = i.Start()
+	require.NoError(t, err)
+	fences, err := gs.StubbingQuery(48.75, 2.1, regionagogo.WithMultipleFences(true))
+	require.NoError(t, err)
+	require.Len(t, fences, 2)
+
+	i = regionagogo.NewKMLImport(gs, strings.NewReader(geoJSONoverlapping), nil, nil, nil)
+	err = i.Start()
+	require.Error(t, err)
+
+	i = regionagogo.NewKMLImport(gs, strings.NewReader(`<gpx></gpx>`), nil, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrInvalidKML, err)
+
+	// a longitude out of range
+	projected := `<kml><Placemark><Polygon><outerBoundaryIs><LinearRing><coordinates>48.7,2.0 48.7,200.6 49.0,200.6 48.7,2.0</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark></kml>`
+	i = regionagogo.NewKMLImport(gs, strings.NewReader(projected), nil, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrOutOfRangeCoordinates, err)
+}
+
+// ewkbMultiPolygon returns the little endian EWKB, with SRID 4326, of polygons made of rings
+func ewkbMultiPolygon(polygons [][][][2]float64) []byte {
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+
+	write(uint8(1))
+	write(uint32(6 | 0x20000000))
+	write(uint32(4326))
+	write(uint32(len(polygons)))
+	for _, rings := range polygons {
+		write(uint8(1))
+		write(uint32(3))
+		write(uint32(len(rings)))
+		for _, ring := range rings {
+			write(uint32(len(ring)))
+			write(ring)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestCSVImport(t *testing.T) {
+	tmpfile, clean := createTempDB(t)
+	defer clean()
+
+	gs, err := NewGeoFenceBoltDB(tmpfile)
+	require.NoError(t, err)
+	defer gs.Close()
+
+	islands := ewkbMultiPolygon([][][][2]float64{
+		{square(10, 45, 11, 46, false)},
+		{square(12, 45, 13, 46, false)},
+	})
+
+	csv := "id,name,geom\n" +
+		`1,"Paris, France","SRID=4326;POLYGON((2.0 48.7,2.6 48.7,2.6 49.0,2.0 49.0,2.0 48.7),(2.2 48.8,2.4 48.8,2.4 48.9,2.2 48.9,2.2 48.8))"` + "\n" +
+		"2,Islands," + hex.EncodeToString(islands) + "\n" +
+		"3,Depot,\n" +
+		`4,Far,"MULTIPOLYGON Z (((20 45 1,21 45 1,21 46 1,20 46 1,20 45 1)))"` + "\n"
+
+	i := regionagogo.NewCSVImport(gs, strings.NewReader(csv), "geom", []string{"name"}, nil, nil)
+	i.KeyField = "id"
+	err = i.Start()
+	require.NoError(t, err)
+
+	tests := []struct {
+		lat, lng float64
+		key      string
+	}{
+		{48.75, 2.1, "1"},
+		{48.85, 2.3, ""},
+		{45.5, 10.5, "2"},
+		{45.5, 12.5, "2"},
+		{45.5, 20.5, "4"},
+	}
+	for _, test := range tests {
+		fences, err := gs.StubbingQuery(test.lat, test.lng)
+		require.NoError(t, err)
+		if test.key == "" {
+			require.Len(t, fences, 0, "%v", test)
+			continue
+		}
+		require.Len(t, fences, 1, "%v", test)
+		require.Equal(t, test.key, fences[0].Key)
+	}
+	require.Equal(t, "Paris, France", gs.FenceByKey("1").Data["name"])
+	require.Nil(t, gs.FenceByKey("3"))
+
+	i = regionagogo.NewCSVImport(gs, strings.NewReader(csv), "wkt", []string{"name"}, nil, nil)
+	err = i.Start()
+	require.Equal(t, regionagogo.ErrInvalidCSV, err)
+
+	// invalid rows are skipped, the next ones are imported
+	csv = "id,name,geom\n" +
+		"5,Nowhere,POINT(1 2)\n" +
+		`6,Mercator,"SRID=3857;POLYGON((0 0,1 0,1 1,0 1,0 0))"` + "\n" +
+		`7,Projected,"POLYGON((500000 0,500001 0,500001 1,500000 0))"` + "\n" +
+		`8,Near,"POLYGON((30 45,30 46,31 46,31 45,30 45))"` + "\n"
+	i = regionagogo.NewCSVImport(gs, strings.NewReader(csv), "geom", []string{"name"}, nil, nil)
+	i.KeyField = "id"
+	err = i.Start()
+	require.NoError(t, err)
+	for _, key := range []string{"5", "6", "7"} {
+		require.Nil(t, gs.FenceByKey(key))
+	}
+	require.Equal(t, "Near", gs.FenceByKey("8").Data["name"])
+
+	_, err = regionagogo.ParseWKB(islands[:len(islands)-8])
+	require.Equal(t, regionagogo.ErrInvalidWKB, err)
+
+	polygons, err := regionagogo.ParseWKT("polygon empty")
+	require.NoError(t, err)
+	require.Len(t, polygons, 0)
+}
@@ -0,0 +1,320 @@
+package boltdb
+
+import (
+	"log"
+	"sort"
+
+	"github.com/Workiva/go-datastructures/augmentedtree"
+	region "github.com/akhenakh/regionagogo"
+	"github.com/akhenakh/regionagogo/geostore"
+	"github.com/golang/geo/s2"
+)
+
+// cellIndex is the in memory index of the covers cells
+// it is not safe for concurrent use, GeoFenceBoltDB protects it with its lock
+type cellIndex interface {
+	// load indexes the cells of all the stored covers into an empty index
+	load(entries []cellEntry)
+
+	// add indexes each cells of the cover with loopID
+	add(fc *geostore.FenceCover, loopID uint64)
+
+	// remove removes loopID from each cells of the cover
+	remove(fc *geostore.FenceCover, loopID uint64)
+
+	// overlapping returns the cell ranges and loopIDs overlapping the cell
+	// loopIDs slices are never modified in place, they can be used once the lock is released
+	overlapping(c s2.CellID) []cellLoops
+}
+
+// appendCoverEntries appends the exterior and interior cells of the cover to entries
+func appendCoverEntries(entries []cellEntry, fc *geostore.FenceCover, loopID uint64) []cellEntry {
+	for _, cell := range fc.Cellunion {
+		entries = append(entries, cellEntry{cell: s2.CellID(cell), loopID: loopID})
+	}
+	for _, cell := range fc.Interior {
+		entries = append(entries, cellEntry{cell: s2.CellID(cell), loopID: loopID, interior: true})
+	}
+	return entries
+}
+
+// containsLoopID returns true if loopID is in loopIDs
+func containsLoopID(loopIDs []uint64, loopID uint64) bool {
+	for _, id := range loopIDs {
+		if id == loopID {
+			return true
+		}
+	}
+	return false
+}
+
+// treeIndex is a cellIndex storing each cell as an interval of an augmented tree
+type treeIndex struct {
+	tree  augmentedtree.Tree
+	debug bool
+}
+
+func newTreeIndex(debug bool) *treeIndex {
+	return &treeIndex{tree: augmentedtree.New(1), debug: debug}
+}
+
+func (ti *treeIndex) load(entries []cellEntry) {
+	for _, e := range entries {
+		ti.addCell(e.cell, e.loopID, e.interior)
+	}
+}
+
+func (ti *treeIndex) add(fc *geostore.FenceCover, loopID uint64) {
+	for _, cell := range fc.Cellunion {
+		ti.addCell(s2.CellID(cell), loopID, false)
+	}
+	for _, cell := range fc.Interior {
+		ti.addCell(s2.CellID(cell), loopID, true)
+	}
+}
+
+func (ti *treeIndex) remove(fc *geostore.FenceCover, loopID uint64) {
+	for _, cell := range fc.Cellunion {
+		ti.removeCell(s2.CellID(cell), loopID, false)
+	}
+	for _, cell := range fc.Interior {
+		ti.removeCell(s2.CellID(cell), loopID, true)
+	}
+}
+
+// find returns the interval of the cell if any
+func (ti *treeIndex) find(cell s2.CellID) *region.S2Interval {
+	s2interval := &region.S2Interval{CellID: cell}
+	for _, existInterval := range ti.tree.Query(s2interval) {
+		if existInterval.LowAtDimension(1) == s2interval.LowAtDimension(1) &&
+			existInterval.HighAtDimension(1) == s2interval.HighAtDimension(1) {
+			return existInterval.(*region.S2Interval)
+		}
+	}
+	return nil
+}
+
+// addCell adds loopID to the cell interval, to its interior loops if interior is true
+func (ti *treeIndex) addCell(cell s2.CellID, loopID uint64, interior bool) {
+	existS2Interval := ti.find(cell)
+	if existS2Interval == nil {
+		// create new interval with current loop
+		existS2Interval = &region.S2Interval{CellID: cell}
+		ti.tree.Add(existS2Interval)
+		if ti.debug {
+			log.Printf("added new interval %s", existS2Interval)
+		}
+	}
+
+	if ti.debug {
+		log.Printf("added %d to interval %s containing %v interior %v", loopID, existS2Interval, existS2Interval.LoopIDs, existS2Interval.InteriorLoopIDs)
+	}
+
+	if interior {
+		existS2Interval.InteriorLoopIDs = append(existS2Interval.InteriorLoopIDs, loopID)
+		return
+	}
+	existS2Interval.LoopIDs = append(existS2Interval.LoopIDs, loopID)
+}
+
+// removeCell removes loopID from the cell interval, from its interior loops if interior is true
+func (ti *treeIndex) removeCell(cell s2.CellID, loopID uint64, interior bool) {
+	existS2Interval := ti.find(cell)
+	if existS2Interval == nil {
+		return
+	}
+
+	// LoopIDs may be shared, never modify it in place
+	if interior {
+		existS2Interval.InteriorLoopIDs = withoutLoopID(existS2Interval.InteriorLoopIDs, loopID)
+	} else {
+		existS2Interval.LoopIDs = withoutLoopID(existS2Interval.LoopIDs, loopID)
+	}
+
+	if len(existS2Interval.LoopIDs) == 0 && len(existS2Interval.InteriorLoopIDs) == 0 {
+		ti.tree.Delete(existS2Interval)
+		if ti.debug {
+			log.Printf("removed empty interval %s", existS2Interval)
+		}
+		return
+	}
+
+	if ti.debug {
+		log.Printf("removed %d from interval %s containing %v interior %v", loopID, existS2Interval, existS2Interval.LoopIDs, existS2Interval.InteriorLoopIDs)
+	}
+}
+
+func (ti *treeIndex) overlapping(c s2.CellID) []cellLoops {
+	var res []cellLoops
+	for _, itv := range ti.tree.Query(&region.S2Interval{CellID: c}) {
+		sitv := itv.(*region.S2Interval)
+		res = append(res, cellLoops{
+			min:      sitv.RangeMin(),
+			max:      sitv.RangeMax(),
+			loopIDs:  sitv.LoopIDs,
+			interior: sitv.InteriorLoopIDs,
+		})
+	}
+	return res
+}
+
+// rangeIndex is a cellIndex flattening the cells into a sorted array of non overlapping
+// leaf cell ranges, a point lookup is a single binary search
+type rangeIndex struct {
+	ranges []cellLoops
+}
+
+func newRangeIndex() *rangeIndex {
+	return &rangeIndex{}
+}
+
+func (ri *rangeIndex) load(entries []cellEntry) {
+	ri.ranges = flattenCells(entries)
+}
+
+func (ri *rangeIndex) add(fc *geostore.FenceCover, loopID uint64) {
+	for _, cell := range fc.Cellunion {
+		ri.update(s2.CellID(cell), func(r cellLoops) cellLoops {
+			r.loopIDs = withLoopID(r.loopIDs, loopID)
+			return r
+		})
+	}
+	for _, cell := range fc.Interior {
+		ri.update(s2.CellID(cell), func(r cellLoops) cellLoops {
+			r.interior = withLoopID(r.interior, loopID)
+			return r
+		})
+	}
+}
+
+func (ri *rangeIndex) remove(fc *geostore.FenceCover, loopID uint64) {
+	for _, cell := range fc.Cellunion {
+		ri.update(s2.CellID(cell), func(r cellLoops) cellLoops {
+			r.loopIDs = withoutLoopID(r.loopIDs, loopID)
+			return r
+		})
+	}
+	for _, cell := range fc.Interior {
+		ri.update(s2.CellID(cell), func(r cellLoops) cellLoops {
+			r.interior = withoutLoopID(r.interior, loopID)
+			return r
+		})
+	}
+}
+
+// update replaces the loops of the ranges of the cell leaves by f(range)
+// f must not modify the loopIDs in place, ranges left without loopIDs are removed
+func (ri *rangeIndex) update(cell s2.CellID, f func(cellLoops) cellLoops) {
+	min, max := cell.RangeMin(), cell.RangeMax()
+
+	// the ranges overlapping the cell, and their neighbours they may be merged with
+	i := sort.Search(len(ri.ranges), func(i int) bool { return ri.ranges[i].max >= min })
+	j := i
+	for j < len(ri.ranges) && ri.ranges[j].min <= max {
+		j++
+	}
+
+	first, last := i, j
+	var repl []cellLoops
+	if i > 0 {
+		first--
+		repl = append(repl, ri.ranges[first])
+	}
+
+	// piece returns the part from lo to hi of r
+	piece := func(r cellLoops, lo, hi s2.CellID) cellLoops {
+		r.min, r.max = lo, hi
+		return r
+	}
+
+	pos := min
+	for _, r := range ri.ranges[i:j] {
+		if r.min < min {
+			repl = append(repl, piece(r, r.min, min-1))
+		}
+		if r.min > pos {
+			repl = append(repl, f(cellLoops{min: pos, max: r.min - 1}))
+		}
+
+		lo, hi := r.min, r.max
+		if lo < min {
+			lo = min
+		}
+		if hi > max {
+			hi = max
+		}
+		repl = append(repl, f(piece(r, lo, hi)))
+
+		if r.max > max {
+			repl = append(repl, piece(r, max+1, r.max))
+		}
+		pos = hi + 1
+	}
+	if pos <= max {
+		repl = append(repl, f(cellLoops{min: pos, max: max}))
+	}
+
+	if j < len(ri.ranges) {
+		repl = append(repl, ri.ranges[j])
+		last++
+	}
+
+	repl = compactRanges(repl)
+
+	ri.ranges = append(ri.ranges[:first], append(repl, ri.ranges[last:]...)...)
+}
+
+func (ri *rangeIndex) overlapping(c s2.CellID) []cellLoops {
+	cmin, cmax := c.RangeMin(), c.RangeMax()
+
+	// first range ending after the cell start
+	i := sort.Search(len(ri.ranges), func(i int) bool { return ri.ranges[i].max >= cmin })
+
+	var res []cellLoops
+	for ; i < len(ri.ranges) && ri.ranges[i].min <= cmax; i++ {
+		res = append(res, ri.ranges[i])
+	}
+
+	return res
+}
+
+// compactRanges removes the ranges without loopIDs and merges the contiguous ranges with the same loopIDs
+// ranges must be sorted, it is compacted in place
+func compactRanges(ranges []cellLoops) []cellLoops {
+	res := ranges[:0]
+	for _, r := range ranges {
+		if len(r.loopIDs) == 0 && len(r.interior) == 0 {
+			continue
+		}
+		if last := len(res) - 1; last >= 0 && res[last].max+1 == r.min &&
+			equalLoopIDs(res[last].loopIDs, r.loopIDs) && equalLoopIDs(res[last].interior, r.interior) {
+			res[last].max = r.max
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// withLoopID returns a copy of the sorted loopIDs with loopID
+func withLoopID(loopIDs []uint64, loopID uint64) []uint64 {
+	i := sort.Search(len(loopIDs), func(i int) bool { return loopIDs[i] >= loopID })
+	if i < len(loopIDs) && loopIDs[i] == loopID {
+		return loopIDs
+	}
+	res := make([]uint64, 0, len(loopIDs)+1)
+	res = append(res, loopIDs[:i]...)
+	res = append(res, loopID)
+	return append(res, loopIDs[i:]...)
+}
+
+// withoutLoopID returns a copy of loopIDs without loopID
+func withoutLoopID(loopIDs []uint64, loopID uint64) []uint64 {
+	res := make([]uint64, 0, len(loopIDs))
+	for _, id := range loopIDs {
+		if id != loopID {
+			res = append(res, id)
+		}
+	}
+	return res
+}
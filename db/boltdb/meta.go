@@ -0,0 +1,286 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	region "github.com/akhenakh/regionagogo"
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// FormatVersion is the version of the database format written by this package
+	FormatVersion = 2
+
+	// minFormatVersion is the oldest format version readable without migration
+	// databases created before the meta bucket are version 0
+	minFormatVersion = 0
+)
+
+var (
+	// keys of the meta bucket
+	versionKey = []byte("version")
+	covererKey = []byte("coverer")
+	importKey  = []byte("import")
+	countKey   = []byte("fences")
+
+	// ErrUnsupportedFormat is returned when opening a database this version can't read
+	ErrUnsupportedFormat = errors.New("unsupported database format version")
+
+	// ErrCovererMismatch is returned when setting covering settings other than the stored fences ones
+	ErrCovererMismatch = errors.New("covering settings differ from the stored fences ones")
+)
+
+// migrations upgrade a database format, migrations[v] upgrades version v to v+1
+// a format change adds its migration here and increments FormatVersion,
+// it must also raise minFormatVersion if older databases can't be read as is
+var migrations = []func(gs *GeoFenceBoltDB, tx *bolt.Tx) error{
+	// version 0 databases only lack the meta bucket, created with the other buckets
+	0: func(gs *GeoFenceBoltDB, tx *bolt.Tx) error { return nil },
+	// version 1 databases lack the fence count, kept up to date by the writes from version 2
+	1: func(gs *GeoFenceBoltDB, tx *bolt.Tx) error {
+		n := tx.Bucket(gs.loopBucket).Stats().KeyN
+		return tx.Bucket(gs.metaBucket).Put(countKey, itob(uint64(n)))
+	},
+}
+
+// Metadata describes a database and how it was built
+type Metadata struct {
+	FormatVersion int                    `json:"format_version"`
+	BuildDate     time.Time              `json:"build_date,omitempty"`
+	Sources       []string               `json:"sources,omitempty"`
+	ImportFields  []string               `json:"import_fields,omitempty"`
+	KeyField      string                 `json:"key_field,omitempty"`
+	Coverer       region.CovererSettings `json:"coverer"`
+	Fences        int                    `json:"fences"`
+}
+
+// importMetadata is the part of the metadata written by RecordImport
+type importMetadata struct {
+	BuildDate    time.Time `json:"build_date"`
+	Sources      []string  `json:"sources"`
+	ImportFields []string  `json:"import_fields"`
+	KeyField     string    `json:"key_field"`
+}
+
+// formatVersion returns the database format version, 0 for databases without
+func (gs *GeoFenceBoltDB) formatVersion(tx *bolt.Tx) int {
+	b := tx.Bucket(gs.metaBucket)
+	if b == nil {
+		return 0
+	}
+	v := b.Get(versionKey)
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+// checkFormat refuses databases written by a newer version,
+// older databases are migrated when writable
+func (gs *GeoFenceBoltDB) checkFormat() error {
+	var version int
+	if err := gs.View(func(tx *bolt.Tx) error {
+		version = gs.formatVersion(tx)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if version > FormatVersion {
+		log.Println("database format version", version, "is newer than", FormatVersion)
+		return ErrUnsupportedFormat
+	}
+
+	if version == FormatVersion {
+		return nil
+	}
+
+	if gs.ro {
+		if version < minFormatVersion {
+			log.Println("database format version", version, "is older than", minFormatVersion, "open it writable to migrate")
+			return ErrUnsupportedFormat
+		}
+		return nil
+	}
+
+	return gs.Update(func(tx *bolt.Tx) error {
+		for v := version; v < FormatVersion; v++ {
+			if err := migrations[v](gs, tx); err != nil {
+				return fmt.Errorf("migrating from format version %d: %s", v, err)
+			}
+			log.Println("migrated database from format version", v, "to", v+1)
+		}
+
+		return tx.Bucket(gs.metaBucket).Put(versionKey, itob(FormatVersion))
+	})
+}
+
+// RecordImport records an import of source into the metadata,
+// sources add up, the build date, importFields and keyField are the last import ones
+func (gs *GeoFenceBoltDB) RecordImport(source string, importFields []string, keyField string) error {
+	if gs.ro {
+		return ErrReadOnly
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.releaseRanges(); err != nil {
+		return err
+	}
+
+	return gs.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(gs.metaBucket)
+
+		var im importMetadata
+		if v := b.Get(importKey); v != nil {
+			if err := json.Unmarshal(v, &im); err != nil {
+				return err
+			}
+		}
+
+		im.BuildDate = time.Now().UTC()
+		im.Sources = append(im.Sources, source)
+		im.ImportFields = importFields
+		im.KeyField = keyField
+
+		buf, err := json.Marshal(im)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(importKey, buf)
+	})
+}
+
+// Metadata returns the database metadata
+func (gs *GeoFenceBoltDB) Metadata() (*Metadata, error) {
+	m := &Metadata{Coverer: region.DefaultCovererSettings}
+
+	err := gs.View(func(tx *bolt.Tx) error {
+		m.FormatVersion = gs.formatVersion(tx)
+
+		m.Fences = gs.fenceCount(tx)
+
+		b := tx.Bucket(gs.metaBucket)
+		if b == nil {
+			return nil
+		}
+
+		if v := b.Get(covererKey); v != nil {
+			if err := json.Unmarshal(v, &m.Coverer); err != nil {
+				return err
+			}
+		}
+
+		if v := b.Get(importKey); v != nil {
+			var im importMetadata
+			if err := json.Unmarshal(v, &im); err != nil {
+				return err
+			}
+			m.BuildDate = im.BuildDate
+			m.Sources = im.Sources
+			m.ImportFields = im.ImportFields
+			m.KeyField = im.KeyField
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// SetCovererSettings persists the covering settings used to import the fences,
+// it returns ErrCovererMismatch if fences are stored with other settings,
+// it should be called before an import so the fences of a db are all covered the same way
+func (gs *GeoFenceBoltDB) SetCovererSettings(cs region.CovererSettings) error {
+	if gs.ro {
+		return ErrReadOnly
+	}
+
+	buf, err := json.Marshal(cs)
+	if err != nil {
+		return err
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.releaseRanges(); err != nil {
+		return err
+	}
+
+	return gs.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(gs.metaBucket)
+
+		// fences imported before the settings were persisted used the default ones
+		if gs.fenceCount(tx) > 0 {
+			stored := region.DefaultCovererSettings
+			if v := b.Get(covererKey); v != nil {
+				if err := json.Unmarshal(v, &stored); err != nil {
+					return err
+				}
+			}
+			if stored != cs {
+				return ErrCovererMismatch
+			}
+		}
+
+		return b.Put(covererKey, buf)
+	})
+}
+
+// CovererSettings returns the covering settings persisted at import,
+// DefaultCovererSettings for databases imported before they were persisted
+func (gs *GeoFenceBoltDB) CovererSettings() (region.CovererSettings, error) {
+	cs := region.DefaultCovererSettings
+
+	err := gs.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(gs.metaBucket)
+		if b == nil {
+			return nil
+		}
+		if v := b.Get(covererKey); v != nil {
+			return json.Unmarshal(v, &cs)
+		}
+		return nil
+	})
+	if err != nil {
+		return region.CovererSettings{}, err
+	}
+
+	return cs, nil
+}
+
+// fenceCount returns the number of stored fences
+func (gs *GeoFenceBoltDB) fenceCount(tx *bolt.Tx) int {
+	if b := tx.Bucket(gs.metaBucket); b != nil {
+		if v := b.Get(countKey); len(v) == 8 {
+			return int(binary.BigEndian.Uint64(v))
+		}
+	}
+
+	// older databases opened read only are not migrated, their fences are counted
+	if b := tx.Bucket(gs.loopBucket); b != nil {
+		return b.Stats().KeyN
+	}
+	return 0
+}
+
+// addFenceCount adds delta to the fence count of the meta bucket
+func (gs *GeoFenceBoltDB) addFenceCount(tx *bolt.Tx, delta int) error {
+	b := tx.Bucket(gs.metaBucket)
+	var count int64
+	if v := b.Get(countKey); len(v) == 8 {
+		count = int64(binary.BigEndian.Uint64(v))
+	}
+	return b.Put(countKey, itob(uint64(count+int64(delta))))
+}
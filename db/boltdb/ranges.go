@@ -0,0 +1,247 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/golang/geo/s2"
+)
+
+// The persisted index is a flattened view of all the covers: a sorted array of
+// non overlapping leaf cell ranges, each with the loopIDs of the cells covering it
+// followed by the loopIDs of the interior cells containing it.
+// It is stored as one value in the index bucket and binary searched in place,
+// bolt memory maps the file so the index is never decoded nor copied to the heap.
+//
+// layout, big endian:
+//
+//	header  magic "RGIX" | version uint32 | ranges count uint64
+//	ranges  min uint64 | max uint64 | first loopID offset uint32 | loopIDs count uint32 | interior count uint32
+//	loopIDs uint64...
+const (
+	rangesMagic     = "RGIX"
+	rangesVersion   = 2
+	rangesHeaderLen = 16
+	rangeLen        = 28
+)
+
+var (
+	// the key of the persisted index in the index bucket
+	rangesKey = []byte("ranges")
+
+	errInvalidRanges = errors.New("invalid persisted index")
+)
+
+// cellLoops is a range of leaf cells and the loopIDs covering it
+type cellLoops struct {
+	min, max s2.CellID
+	loopIDs  []uint64
+
+	// interior are the loopIDs entirely containing the range
+	interior []uint64
+}
+
+// cellRanges is a persisted index read from its binary representation
+type cellRanges struct {
+	data []byte
+	n    int
+}
+
+// newCellRanges returns the index stored in data, data is used in place
+func newCellRanges(data []byte) (*cellRanges, error) {
+	if len(data) < rangesHeaderLen || string(data[:4]) != rangesMagic {
+		return nil, errInvalidRanges
+	}
+	if binary.BigEndian.Uint32(data[4:8]) != rangesVersion {
+		return nil, errInvalidRanges
+	}
+
+	n := binary.BigEndian.Uint64(data[8:16])
+	if n > uint64(len(data)-rangesHeaderLen)/rangeLen {
+		return nil, errInvalidRanges
+	}
+
+	// every range loopIDs must be in data, lookups in a truncated or corrupt index would panic
+	ids := uint64(len(data)-rangesHeaderLen-int(n)*rangeLen) / 8
+	for i := 0; i < int(n); i++ {
+		r := data[rangesHeaderLen+i*rangeLen:]
+		first := uint64(binary.BigEndian.Uint32(r[16:]))
+		count := uint64(binary.BigEndian.Uint32(r[20:])) + uint64(binary.BigEndian.Uint32(r[24:]))
+		if first+count > ids {
+			return nil, errInvalidRanges
+		}
+	}
+
+	return &cellRanges{data: data, n: int(n)}, nil
+}
+
+// bounds returns the range i min and max cells
+func (cr *cellRanges) bounds(i int) (s2.CellID, s2.CellID) {
+	r := cr.data[rangesHeaderLen+i*rangeLen:]
+	return s2.CellID(binary.BigEndian.Uint64(r)), s2.CellID(binary.BigEndian.Uint64(r[8:]))
+}
+
+// loopIDs returns a copy of the range i loopIDs and interior loopIDs
+func (cr *cellRanges) loopIDs(i int) ([]uint64, []uint64) {
+	r := cr.data[rangesHeaderLen+i*rangeLen:]
+	offset := rangesHeaderLen + cr.n*rangeLen + int(binary.BigEndian.Uint32(r[16:]))*8
+	count := int(binary.BigEndian.Uint32(r[20:]))
+	interiorCount := int(binary.BigEndian.Uint32(r[24:]))
+
+	read := func(offset, count int) []uint64 {
+		if count == 0 {
+			return nil
+		}
+		loopIDs := make([]uint64, count)
+		for j := range loopIDs {
+			loopIDs[j] = binary.BigEndian.Uint64(cr.data[offset+j*8:])
+		}
+		return loopIDs
+	}
+
+	return read(offset, count), read(offset+count*8, interiorCount)
+}
+
+// overlapping returns the ranges overlapping the cell c
+func (cr *cellRanges) overlapping(c s2.CellID) []cellLoops {
+	cmin, cmax := c.RangeMin(), c.RangeMax()
+
+	// first range ending after the cell start
+	i := sort.Search(cr.n, func(i int) bool {
+		_, max := cr.bounds(i)
+		return max >= cmin
+	})
+
+	var res []cellLoops
+	for ; i < cr.n; i++ {
+		min, max := cr.bounds(i)
+		if min > cmax {
+			break
+		}
+		loopIDs, interior := cr.loopIDs(i)
+		res = append(res, cellLoops{min: min, max: max, loopIDs: loopIDs, interior: interior})
+	}
+
+	return res
+}
+
+// cellEntry is a cell of a fence cover, interior for a cell of its interior covering
+type cellEntry struct {
+	cell     s2.CellID
+	loopID   uint64
+	interior bool
+}
+
+// flattenCells flattens the cells into sorted non overlapping leaf cell ranges
+func flattenCells(entries []cellEntry) []cellLoops {
+	// sweep the leaf cells, a cell is active from its first leaf to its last leaf
+	type event struct {
+		pos      uint64
+		loopID   uint64
+		start    bool
+		interior bool
+	}
+
+	events := make([]event, 0, 2*len(entries))
+	for _, e := range entries {
+		events = append(events,
+			event{pos: uint64(e.cell.RangeMin()), loopID: e.loopID, start: true, interior: e.interior},
+			event{pos: uint64(e.cell.RangeMax()) + 1, loopID: e.loopID, interior: e.interior})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].pos < events[j].pos })
+
+	// sortedKeys returns the active loopIDs, nil if none
+	sortedKeys := func(active map[uint64]int) []uint64 {
+		if len(active) == 0 {
+			return nil
+		}
+		loopIDs := make([]uint64, 0, len(active))
+		for loopID := range active {
+			loopIDs = append(loopIDs, loopID)
+		}
+		sort.Slice(loopIDs, func(a, b int) bool { return loopIDs[a] < loopIDs[b] })
+		return loopIDs
+	}
+
+	var ranges []cellLoops
+	active := make(map[uint64]int)
+	activeInterior := make(map[uint64]int)
+	for i := 0; i < len(events); {
+		pos := events[i].pos
+		for ; i < len(events) && events[i].pos == pos; i++ {
+			a := active
+			if events[i].interior {
+				a = activeInterior
+			}
+			if events[i].start {
+				a[events[i].loopID]++
+				continue
+			}
+			if a[events[i].loopID]--; a[events[i].loopID] == 0 {
+				delete(a, events[i].loopID)
+			}
+		}
+
+		if (len(active) == 0 && len(activeInterior) == 0) || i == len(events) {
+			continue
+		}
+
+		ranges = append(ranges, cellLoops{
+			min:      s2.CellID(pos),
+			max:      s2.CellID(events[i].pos - 1),
+			loopIDs:  sortedKeys(active),
+			interior: sortedKeys(activeInterior),
+		})
+	}
+
+	return compactRanges(ranges)
+}
+
+// buildCellRanges flattens the cells into the persisted index binary representation
+func buildCellRanges(entries []cellEntry) []byte {
+	ranges := flattenCells(entries)
+
+	var count int
+	for _, r := range ranges {
+		count += len(r.loopIDs) + len(r.interior)
+	}
+
+	data := make([]byte, rangesHeaderLen+len(ranges)*rangeLen+count*8)
+	copy(data, rangesMagic)
+	binary.BigEndian.PutUint32(data[4:], rangesVersion)
+	binary.BigEndian.PutUint64(data[8:], uint64(len(ranges)))
+
+	var offset int
+	loops := data[rangesHeaderLen+len(ranges)*rangeLen:]
+	for i, r := range ranges {
+		b := data[rangesHeaderLen+i*rangeLen:]
+		binary.BigEndian.PutUint64(b, uint64(r.min))
+		binary.BigEndian.PutUint64(b[8:], uint64(r.max))
+		binary.BigEndian.PutUint32(b[16:], uint32(offset))
+		binary.BigEndian.PutUint32(b[20:], uint32(len(r.loopIDs)))
+		binary.BigEndian.PutUint32(b[24:], uint32(len(r.interior)))
+		for _, loopID := range r.loopIDs {
+			binary.BigEndian.PutUint64(loops[offset*8:], loopID)
+			offset++
+		}
+		for _, loopID := range r.interior {
+			binary.BigEndian.PutUint64(loops[offset*8:], loopID)
+			offset++
+		}
+	}
+
+	return data
+}
+
+func equalLoopIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package boltdb
+
+import (
+	"math"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+)
+
+// The exact rect query relations are tested against the s2.Rect itself:
+// its parallels are not geodesics, a polygon joining its vertices cuts across them
+// for large rects and degenerates at the poles.
+
+// rectIntersects returns true if the polygon and the rect have a point in common
+func rectIntersects(rect s2.Rect, p *s2.Polygon) bool {
+	if rect.IsEmpty() || !rect.Intersects(p.RectBound()) {
+		return false
+	}
+
+	// the rect is inside the polygon, or the polygon boundary enters the rect
+	if p.ContainsPoint(s2.PointFromLatLng(rect.Center())) {
+		return true
+	}
+	return rectHasVertex(rect, p) || rectCrossesBoundary(rect, p)
+}
+
+// rectContained returns true if the rect is inside the polygon
+func rectContained(rect s2.Rect, p *s2.Polygon) bool {
+	if rect.IsEmpty() || !p.RectBound().Contains(rect) {
+		return false
+	}
+
+	// the polygon boundary, holes included, stays out of the rect
+	if rectHasVertex(rect, p) || rectCrossesBoundary(rect, p) {
+		return false
+	}
+	return p.ContainsPoint(s2.PointFromLatLng(rect.Center()))
+}
+
+// rectHasVertex returns true if one of the polygon vertices is in the rect
+func rectHasVertex(rect s2.Rect, p *s2.Polygon) bool {
+	for _, l := range p.Loops() {
+		for _, v := range l.Vertices() {
+			if rect.ContainsPoint(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rectCrossesBoundary returns true if one of the polygon edges crosses the rect boundary
+func rectCrossesBoundary(rect s2.Rect, p *s2.Polygon) bool {
+	// meridians are geodesics, split in two so a pole to pole meridian is not a 180° edge
+	var meridians [][2]s2.Point
+	if !rect.Lng.IsFull() {
+		mid := s1.Angle(rect.Lat.Center())
+		for _, lng := range []s1.Angle{s1.Angle(rect.Lng.Lo), s1.Angle(rect.Lng.Hi)} {
+			lo := s2.PointFromLatLng(s2.LatLng{Lat: s1.Angle(rect.Lat.Lo), Lng: lng})
+			m := s2.PointFromLatLng(s2.LatLng{Lat: mid, Lng: lng})
+			hi := s2.PointFromLatLng(s2.LatLng{Lat: s1.Angle(rect.Lat.Hi), Lng: lng})
+			meridians = append(meridians, [2]s2.Point{lo, m}, [2]s2.Point{m, hi})
+		}
+	}
+
+	// a parallel at a pole is a single point
+	var parallels []s1.Angle
+	for _, lat := range []float64{rect.Lat.Lo, rect.Lat.Hi} {
+		if math.Abs(lat) < math.Pi/2 {
+			parallels = append(parallels, s1.Angle(lat))
+		}
+	}
+
+	for _, l := range p.Loops() {
+		for i := 0; i < l.NumEdges(); i++ {
+			e := l.Edge(i)
+			for _, m := range meridians {
+				if s2.CrossingSign(e.V0, e.V1, m[0], m[1]) == s2.Cross {
+					return true
+				}
+			}
+			for _, lat := range parallels {
+				if crossesParallel(e.V0, e.V1, lat, rect.Lng) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// crossesParallel returns true if the edge ab crosses the parallel lat inside the lng interval,
+// it follows the unexported intersectsLatEdge of the s2 package
+func crossesParallel(a, b s2.Point, lat s1.Angle, lng s1.Interval) bool {
+	// the normal to the plane of ab pointing north
+	z := a.PointCross(b).Normalize()
+	if z.Z < 0 {
+		z = z.Mul(-1)
+	}
+
+	// x is the direction where the great circle through ab reaches its maximum latitude
+	y := z.Cross(s2.PointFromCoords(0, 0, 1).Vector).Normalize()
+	x := y.Cross(z)
+
+	// the angle from x where the great circle crosses the parallel
+	sinLat := math.Sin(lat.Radians())
+	if math.Abs(sinLat) >= x.Z {
+		return false
+	}
+	cosTheta := sinLat / x.Z
+	sinTheta := math.Sqrt(1 - cosTheta*cosTheta)
+	theta := math.Atan2(sinTheta, cosTheta)
+
+	// the great circle crosses the parallel at +/- theta, in the edge and the lng interval or not
+	abTheta := s1.IntervalFromPointPair(math.Atan2(a.Dot(y), a.Dot(x)), math.Atan2(b.Dot(y), b.Dot(x)))
+	if abTheta.Contains(theta) {
+		isect := x.Mul(cosTheta).Add(y.Mul(sinTheta))
+		if lng.Contains(math.Atan2(isect.Y, isect.X)) {
+			return true
+		}
+	}
+	if abTheta.Contains(-theta) {
+		isect := x.Mul(cosTheta).Sub(y.Mul(sinTheta))
+		if lng.Contains(math.Atan2(isect.Y, isect.X)) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,10 @@
 package regionagogo
 
 import (
+	"math"
+
 	"github.com/akhenakh/regionagogo/geostore"
+	"github.com/golang/geo/s1"
 	"github.com/golang/geo/s2"
 	"github.com/kpawlik/geojson"
 )
@@ -10,10 +13,28 @@ import (
 type Fences []*Fence
 
 // Fence is an s2 represented FenceStorage
-// it contains an S2 loop and the associated metadata
+// it contains an S2 polygon and the associated metadata
+// the polygon can be made of several parts, each exterior loop followed by its holes
 type Fence struct {
-	Data map[string]string `json:"data"`
-	Loop *s2.Loop          `json:"-"`
+	ID      uint64            `json:"id"`
+	Key     string            `json:"key,omitempty"`
+	Data    map[string]string `json:"data"`
+	Polygon *s2.Polygon       `json:"-"`
+
+	// Distance in meters from the query center, only set by exact queries
+	// on a copy of the fence, 0 and omitted when the center is inside the fence
+	Distance float64 `json:"distance,omitempty"`
+
+	// BoundaryDistance in meters from the queried point to the closest edge
+	// and BoundaryPoint the closest point on the edges, only set when asked on a copy of the fence
+	BoundaryDistance float64 `json:"boundary_distance,omitempty"`
+	BoundaryPoint    *LatLng `json:"boundary_point,omitempty"`
+}
+
+// LatLng is a position in degrees
+type LatLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
 }
 
 // NewFenceFromStorage returns a Fence from a FenceStorage
@@ -23,58 +44,120 @@ func NewFenceFromStorage(rs *geostore.FenceStorage) *Fence {
 		return nil
 	}
 
-	points := make([]s2.Point, len(rs.Points))
-	for i, c := range rs.Points {
-		// Points in Storage are lat lng points
-		ll := s2.LatLngFromDegrees(float64(c.Lat), float64(c.Lng))
-		point := s2.PointFromLatLng(ll)
-		points[i] = point
+	var loops []*s2.Loop
+
+	// databases created before holes support only store the exterior loop points
+	if len(rs.Loops) == 0 {
+		loops = append(loops, loopFromStorage(rs.Points))
 	}
 
-	l := s2.LoopFromPoints(points)
+	for _, ls := range rs.Loops {
+		loops = append(loops, loopFromStorage(ls.Points))
+	}
 
-	return &Fence{Data: rs.Data, Loop: l}
+	return &Fence{Key: rs.Key, Data: rs.Data, Polygon: s2.PolygonFromLoops(loops)}
 }
 
-// ToGeoJSON transforms a Region to a valid GeoJSON
-func (f *Fence) ToGeoJSON() *geojson.FeatureCollection {
-	var geo geojson.FeatureCollection
+// loopFromStorage returns an s2 loop from storage points
+func loopFromStorage(cpoints []*geostore.CPoint) *s2.Loop {
+	points := make([]s2.Point, len(cpoints))
+	for i, c := range cpoints {
+		// Points in Storage are lat lng points
+		ll := s2.LatLngFromDegrees(float64(c.Lat), float64(c.Lng))
+		points[i] = s2.PointFromLatLng(ll)
+	}
 
-	var cs []geojson.Coordinate
+	return s2.LoopFromPoints(points)
+}
 
-	points := f.Loop.Vertices()
-	for i, p := range points {
+// loopCoordinates returns a closed GeoJSON ring from an s2 loop,
+// holes are returned clockwise as expected by GeoJSON
+func loopCoordinates(l *s2.Loop) geojson.Coordinates {
+	points := l.Vertices()
+	cs := make(geojson.Coordinates, 0, len(points)+1)
+	for _, p := range points {
 		ll := s2.LatLngFromPoint(p)
 		c := geojson.Coordinate{
 			geojson.CoordType(ll.Lng.Degrees()),
 			geojson.CoordType(ll.Lat.Degrees()),
 		}
-		if i == len(points)-1 {
-			break
-		}
 		cs = append(cs, c)
 	}
 
-	coordinates := []geojson.Coordinates{cs}
+	if len(cs) == 0 {
+		return cs
+	}
 
-	poly := &geojson.Polygon{
-		Type:        "Polygon",
-		Coordinates: coordinates,
+	// first point is last point
+	cs = append(cs, cs[0])
+
+	if l.IsHole() {
+		reversePolygon(cs)
+	}
+
+	return cs
+}
+
+// geometry returns the GeoJSON geometry of the fence
+// a Polygon or a MultiPolygon for fences made of multiple parts
+func (f *Fence) geometry() interface{} {
+	var polygons []geojson.MultiLine
+
+	// loops are ordered depth first, a hole is attached to the polygon of its parent shell
+	polygonOf := make(map[int]int)
+	for k, l := range f.Polygon.Loops() {
+		if !l.IsHole() {
+			polygonOf[k] = len(polygons)
+			polygons = append(polygons, geojson.MultiLine{loopCoordinates(l)})
+			continue
+		}
+		parent, _ := f.Polygon.Parent(k)
+		pi := polygonOf[parent]
+		polygons[pi] = append(polygons[pi], loopCoordinates(l))
 	}
 
+	if len(polygons) == 1 {
+		return &geojson.Polygon{
+			Type:        "Polygon",
+			Coordinates: polygons[0],
+		}
+	}
+
+	return &geojson.MultiPolygon{
+		Type:        "MultiPolygon",
+		Coordinates: polygons,
+	}
+}
+
+// feature returns the fence as a GeoJSON feature identified by the fence id,
+// the fence key is added to its properties as key unless the data already has one
+func (f *Fence) feature() *geojson.Feature {
 	properties := make(map[string]interface{})
 
 	for k, v := range f.Data {
 		properties[k] = v
 	}
+	if _, ok := properties["key"]; !ok && f.Key != "" {
+		properties["key"] = f.Key
+	}
 
-	geo.Features = []*geojson.Feature{
-		{
-			Type:       "Feature",
-			Geometry:   poly,
-			Properties: properties,
-		},
+	feature := &geojson.Feature{
+		Type:       "Feature",
+		Geometry:   f.geometry(),
+		Properties: properties,
+	}
+	// a fence not stored yet has no id
+	if f.ID != 0 {
+		feature.Id = f.ID
 	}
+	return feature
+}
+
+// ToGeoJSON transforms a Region to a valid GeoJSON
+func (f *Fence) ToGeoJSON() *geojson.FeatureCollection {
+	var geo geojson.FeatureCollection
+
+	geo.Features = []*geojson.Feature{f.feature()}
 	geo.Type = "FeatureCollection"
 
 	return &geo
@@ -83,47 +166,71 @@ func (f *Fence) ToGeoJSON() *geojson.FeatureCollection {
 // ToGeoJSON transforms a set of Fences to a valid GeoJSON
 func (f *Fences) ToGeoJSON() *geojson.FeatureCollection {
 	var geo geojson.FeatureCollection
-	var features []*geojson.Feature
+	// an empty collection still has a features array
+	features := make([]*geojson.Feature, 0, len(*f))
 
 	for _, fence := range *f {
-		var cs []geojson.Coordinate
-
-		points := fence.Loop.Vertices()
-		for _, p := range points {
-			ll := s2.LatLngFromPoint(p)
-			c := geojson.Coordinate{
-				geojson.CoordType(ll.Lng.Degrees()),
-				geojson.CoordType(ll.Lat.Degrees()),
-			}
-			cs = append(cs, c)
-		}
+		features = append(features, fence.feature())
+	}
 
-		coordinates := []geojson.Coordinates{cs}
+	geo.Features = features
+	geo.Type = "FeatureCollection"
 
-		poly := &geojson.Polygon{
-			Type:        "Polygon",
-			Coordinates: coordinates,
-		}
+	return &geo
+}
 
-		properties := make(map[string]interface{})
+// DistanceToBoundary returns the angular distance from p to the closest edge of the fence
+func (f *Fence) DistanceToBoundary(p s2.Point) s1.Angle {
+	_, d := f.ClosestBoundaryPoint(p)
+	return d
+}
 
-		for k, v := range fence.Data {
-			properties[k] = v
+// ClosestBoundaryPoint returns the point on the fence edges closest to p and its angular distance to p
+func (f *Fence) ClosestBoundaryPoint(p s2.Point) (s2.Point, s1.Angle) {
+	min := s1.Angle(math.Inf(1))
+	var closest s2.Point
+	for _, l := range f.Polygon.Loops() {
+		// Vertex wraps around, the last edge closes the loop
+		for i := 0; i < l.NumVertices(); i++ {
+			a, b := l.Vertex(i), l.Vertex(i+1)
+			if d := s2.DistanceFromSegment(p, a, b); d < min {
+				min = d
+				closest = s2.Project(p, a, b)
+			}
 		}
+	}
+	return closest, min
+}
 
-		f := &geojson.Feature{
-			Type:       "Feature",
-			Geometry:   poly,
-			Properties: properties,
-		}
+// DistanceToPoint returns the angular distance from p to the fence, 0 when p is inside the fence
+func (f *Fence) DistanceToPoint(p s2.Point) s1.Angle {
+	if f.Polygon.ContainsPoint(p) {
+		return 0
+	}
+	return f.DistanceToBoundary(p)
+}
 
-		features = append(features, f)
+// WithinCap returns true if the fence is inside c
+func (f *Fence) WithinCap(c s2.Cap) bool {
+	if c.IsFull() {
+		return true
 	}
 
-	geo.Features = features
-	geo.Type = "FeatureCollection"
+	// caps larger than a hemisphere are not convex, an edge between two vertices inside c can leave it,
+	// the edges are checked against the outside of c, a cap too
+	outside := c.Complement()
+	center, radius := outside.Center(), outside.Radius()
+	for _, l := range f.Polygon.Loops() {
+		// Vertex wraps around, the last edge closes the loop
+		for i := 0; i < l.NumVertices(); i++ {
+			if s2.DistanceFromSegment(center, l.Vertex(i), l.Vertex(i+1)) < radius {
+				return false
+			}
+		}
+	}
 
-	return &geo
+	// no edge crosses the outside of c, the fence is around it or away from it
+	return !f.Polygon.ContainsPoint(center)
 }
 
 type BySize []*Fence
@@ -132,5 +239,11 @@ func (d BySize) Len() int      { return len(d) }
 func (d BySize) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
 func (d BySize) Less(i, j int) bool {
 	// use approximated area to decide ordering
-	return d[i].Loop.RectBound().Area() < d[j].Loop.RectBound().Area()
+	return d[i].Polygon.RectBound().Area() < d[j].Polygon.RectBound().Area()
 }
+
+type ByDistance []*Fence
+
+func (d ByDistance) Len() int           { return len(d) }
+func (d ByDistance) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d ByDistance) Less(i, j int) bool { return d[i].Distance < d[j].Distance }
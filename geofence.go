@@ -1,12 +1,23 @@
 package regionagogo
 
 import (
+	"errors"
+
 	"github.com/akhenakh/regionagogo/geostore"
-	"github.com/golang/geo/s2"
 )
 
 var (
-	defaultCoverer = &s2.RegionCoverer{MinLevel: 1, MaxLevel: 24, MaxCells: 32}
+	// ErrFenceNotFound is returned when operating on a fence id not present in the DB
+	ErrFenceNotFound = errors.New("fence not found")
+
+	// ErrKeyExists is returned when storing a fence with a key already used by another fence
+	ErrKeyExists = errors.New("fence key already exists")
+
+	// ErrInvalidFence is returned when a feature can't be turned into a valid fence
+	ErrInvalidFence = errors.New("invalid fence")
+
+	// ErrUnsupportedRelation is returned when a query does not support the requested relation
+	ErrUnsupportedRelation = errors.New("unsupported relation for this query")
 )
 
 // GeoFenceDB is the main interface to store and query your geo database
@@ -14,17 +25,33 @@ type GeoFenceDB interface {
 	// returns a Fence by it's storage id
 	FenceByID(loopID uint64) *Fence
 
+	// returns a Fence by its user supplied key
+	FenceByKey(key string) *Fence
+
 	// returns the fence for the corresponding lat, lng coordinates
 	StubbingQuery(lat, lng float64, opts ...QueryOptionsFunc) (Fences, error)
 
+	// BatchStubbingQuery returns the fences for each point, in the same order as points
+	BatchStubbingQuery(points []LatLng, opts ...QueryOptionsFunc) ([]Fences, error)
+
 	// RectQuery perform rectangular query ur upper right bl bottom left
 	RectQuery(urlat, urlng, bllat, bllng float64, opts ...QueryOptionsFunc) (Fences, error)
 
 	// RadiusQuery is performing a radius query
 	RadiusQuery(lat, lng, radius float64, opts ...QueryOptionsFunc) (Fences, error)
 
-	// Store a Fence into the DB
-	StoreFence(rs *geostore.FenceStorage, cover []uint64) error
+	// NearestQuery returns the k fences closest to the position, nearest first,
+	// with their distance in meters, only fences within maxDistance meters are returned, 0 for no limit
+	NearestQuery(lat, lng float64, k int, maxDistance float64) (Fences, error)
+
+	// Store a Fence and its cover into the DB
+	StoreFence(rs *geostore.FenceStorage, cover *geostore.FenceCover) error
+
+	// DeleteFence removes a Fence and its cover from the DB
+	DeleteFence(loopID uint64) error
+
+	// UpdateFence replaces the Fence and its cover stored under loopID
+	UpdateFence(loopID uint64, rs *geostore.FenceStorage, cover *geostore.FenceCover) error
 
 	// Close the DB
 	Close() error
@@ -36,11 +63,50 @@ type QueryOptionsFunc func(*QueryOptions)
 type QueryOptions struct {
 	// Returns all fences when multiple fences match
 	MultipleFences bool
+
+	// Relation between the query region and the returned fences
+	Relation Relation
+
+	// Computes the distance from the point to the fences boundary
+	BoundaryDistance bool
 }
 
+// Relation is the spatial predicate tested between a query region and a fence
+type Relation int
+
+const (
+	// Approximate is the fast default, only the covers or the bounding rects are tested:
+	// RadiusQuery matches fences whose cover touches the cap cover, it may return fences outside the cap,
+	// RectQuery matches fences whose bounding rect is inside the query rect, it may miss fences inside the rect
+	Approximate Relation = iota
+
+	// Intersects matches fences sharing at least one point with the query region
+	Intersects
+
+	// Within matches fences entirely inside the query region
+	Within
+
+	// Contains matches fences entirely containing the query region
+	Contains
+)
+
 // WithMultipleFences enable multi fences in responses
 func WithMultipleFences(mf bool) QueryOptionsFunc {
 	return func(o *QueryOptions) {
 		o.MultipleFences = mf
 	}
 }
+
+// WithBoundaryDistance enables the distance to the fences boundary in stubbing queries results
+func WithBoundaryDistance(bd bool) QueryOptionsFunc {
+	return func(o *QueryOptions) {
+		o.BoundaryDistance = bd
+	}
+}
+
+// WithRelation selects the spatial predicate used by region queries
+func WithRelation(r Relation) QueryOptionsFunc {
+	return func(o *QueryOptions) {
+		o.Relation = r
+	}
+}
@@ -9,6 +9,7 @@ It is generated from these files:
 
 It has these top-level messages:
 	FenceStorage
+	LoopStorage
 	CPoint
 	FenceCover
 */
@@ -31,8 +32,13 @@ const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 // FenceStorage is used to represent a Fence in storage
 type FenceStorage struct {
+	// points of the exterior loop, only used by databases prior to loops
 	Points []*CPoint         `protobuf:"bytes,1,rep,name=points" json:"points,omitempty"`
 	Data   map[string]string `protobuf:"bytes,2,rep,name=data" json:"data,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// loops of the fence, for each polygon the exterior loop followed by its holes
+	Loops []*LoopStorage `protobuf:"bytes,3,rep,name=loops" json:"loops,omitempty"`
+	// optional user supplied key, unique in the DB
+	Key string `protobuf:"bytes,4,opt,name=key" json:"key,omitempty"`
 }
 
 func (m *FenceStorage) Reset()                    { *m = FenceStorage{} }
@@ -54,6 +60,37 @@ func (m *FenceStorage) GetData() map[string]string {
 	return nil
 }
 
+func (m *FenceStorage) GetLoops() []*LoopStorage {
+	if m != nil {
+		return m.Loops
+	}
+	return nil
+}
+
+func (m *FenceStorage) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+// LoopStorage is used to represent a single loop of a Fence
+type LoopStorage struct {
+	Points []*CPoint `protobuf:"bytes,1,rep,name=points" json:"points,omitempty"`
+}
+
+func (m *LoopStorage) Reset()                    { *m = LoopStorage{} }
+func (m *LoopStorage) String() string            { return proto.CompactTextString(m) }
+func (*LoopStorage) ProtoMessage()               {}
+func (*LoopStorage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *LoopStorage) GetPoints() []*CPoint {
+	if m != nil {
+		return m.Points
+	}
+	return nil
+}
+
 // CPoint represent a coordinates lat & lng
 type CPoint struct {
 	Lat float32 `protobuf:"fixed32,1,opt,name=lat" json:"lat,omitempty"`
@@ -63,7 +100,7 @@ type CPoint struct {
 func (m *CPoint) Reset()                    { *m = CPoint{} }
 func (m *CPoint) String() string            { return proto.CompactTextString(m) }
 func (*CPoint) ProtoMessage()               {}
-func (*CPoint) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*CPoint) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 func (m *CPoint) GetLat() float32 {
 	if m != nil {
@@ -81,13 +118,16 @@ func (m *CPoint) GetLng() float32 {
 
 // FenceCover is used to store an s2 coverage of a fence
 type FenceCover struct {
+	// exterior covering, the cells covering the fence
 	Cellunion []uint64 `protobuf:"varint,1,rep,packed,name=cellunion" json:"cellunion,omitempty"`
+	// interior covering, cells entirely inside the fence, empty for databases prior to interior coverings
+	Interior []uint64 `protobuf:"varint,2,rep,packed,name=interior" json:"interior,omitempty"`
 }
 
 func (m *FenceCover) Reset()                    { *m = FenceCover{} }
 func (m *FenceCover) String() string            { return proto.CompactTextString(m) }
 func (*FenceCover) ProtoMessage()               {}
-func (*FenceCover) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*FenceCover) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 func (m *FenceCover) GetCellunion() []uint64 {
 	if m != nil {
@@ -96,8 +136,16 @@ func (m *FenceCover) GetCellunion() []uint64 {
 	return nil
 }
 
+func (m *FenceCover) GetInterior() []uint64 {
+	if m != nil {
+		return m.Interior
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*FenceStorage)(nil), "geostore.FenceStorage")
+	proto.RegisterType((*LoopStorage)(nil), "geostore.LoopStorage")
 	proto.RegisterType((*CPoint)(nil), "geostore.CPoint")
 	proto.RegisterType((*FenceCover)(nil), "geostore.FenceCover")
 }
@@ -105,19 +153,22 @@ func init() {
 func init() { proto.RegisterFile("geostore.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 220 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x90, 0xc1, 0x4a, 0x03, 0x31,
-	0x10, 0x86, 0x49, 0x5a, 0x17, 0x77, 0x14, 0x29, 0xc1, 0x43, 0x10, 0x0f, 0xcb, 0x9e, 0x16, 0x91,
-	0x3d, 0xa8, 0xa0, 0x78, 0xad, 0x7a, 0x96, 0xf8, 0x04, 0xb1, 0x0e, 0xa1, 0x18, 0x32, 0x25, 0x9d,
-	0x16, 0xfa, 0x44, 0xbe, 0xa6, 0x64, 0x56, 0x77, 0x7b, 0x9b, 0xf9, 0xe6, 0xff, 0xc2, 0x64, 0xe0,
-	0x22, 0x20, 0x6d, 0x99, 0x32, 0xf6, 0x9b, 0x4c, 0x4c, 0xe6, 0xf4, 0xbf, 0x6f, 0x7f, 0x14, 0x9c,
-	0xbf, 0x61, 0x5a, 0xe1, 0x07, 0x53, 0xf6, 0x01, 0x4d, 0x07, 0xd5, 0x86, 0xd6, 0x89, 0xb7, 0x56,
-	0x35, 0xb3, 0xee, 0xec, 0x6e, 0xd1, 0x8f, 0xee, 0xf2, 0xbd, 0x0c, 0xdc, 0xdf, 0xdc, 0x3c, 0xc0,
-	0xfc, 0xcb, 0xb3, 0xb7, 0x5a, 0x72, 0xcd, 0x94, 0x3b, 0x7e, 0xaf, 0x7f, 0xf1, 0xec, 0x5f, 0x13,
-	0xe7, 0x83, 0x93, 0xf4, 0xd5, 0x23, 0xd4, 0x23, 0x32, 0x0b, 0x98, 0x7d, 0xe3, 0xc1, 0xaa, 0x46,
-	0x75, 0xb5, 0x2b, 0xa5, 0xb9, 0x84, 0x93, 0xbd, 0x8f, 0x3b, 0xb4, 0x5a, 0xd8, 0xd0, 0x3c, 0xeb,
-	0x27, 0xd5, 0xde, 0x42, 0x35, 0x2c, 0x50, 0xac, 0xe8, 0x59, 0x2c, 0xed, 0x4a, 0x29, 0x24, 0x05,
-	0x71, 0x0a, 0x49, 0xa1, 0xbd, 0x01, 0x90, 0x35, 0x96, 0xb4, 0xc7, 0x6c, 0xae, 0xa1, 0x5e, 0x61,
-	0x8c, 0xbb, 0xb4, 0xa6, 0x24, 0xff, 0x9a, 0xbb, 0x09, 0x7c, 0x56, 0x72, 0x94, 0xfb, 0xdf, 0x00,
-	0x00, 0x00, 0xff, 0xff, 0xa4, 0x4b, 0x2e, 0x0c, 0x26, 0x01, 0x00, 0x00,
+	// 261 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0x8d, 0x51, 0x4f, 0x4b, 0xc3, 0x30,
+	0x14, 0x27, 0x6d, 0x57, 0xd6, 0x37, 0x91, 0x11, 0x14, 0xca, 0xf0, 0x50, 0x7a, 0x2a, 0x28, 0x3d,
+	0xa8, 0x30, 0xf1, 0xba, 0xb9, 0x93, 0x87, 0x91, 0x7d, 0x82, 0x38, 0x1f, 0xa5, 0x18, 0x92, 0x92,
+	0x66, 0x83, 0x7d, 0x61, 0x3f, 0x87, 0xcd, 0xeb, 0xd6, 0xee, 0xe8, 0x2d, 0xbf, 0x7f, 0xef, 0x97,
+	0x97, 0xc0, 0x6d, 0x85, 0xa6, 0x75, 0xc6, 0x62, 0xd9, 0x58, 0xe3, 0x0c, 0x9f, 0x5e, 0x70, 0xfe,
+	0xcb, 0xe0, 0x66, 0x83, 0x7a, 0x8f, 0xbb, 0x0e, 0xca, 0x0a, 0x79, 0x01, 0x71, 0x63, 0x6a, 0xed,
+	0xda, 0x94, 0x65, 0x61, 0x31, 0x7b, 0x9e, 0x97, 0x43, 0x76, 0xb5, 0xf5, 0x82, 0x38, 0xeb, 0xfc,
+	0x15, 0xa2, 0x6f, 0xe9, 0x64, 0x1a, 0x90, 0x2f, 0x1b, 0x7d, 0xd7, 0xf3, 0xca, 0x75, 0x67, 0xf9,
+	0xd0, 0xce, 0x9e, 0x04, 0xb9, 0xf9, 0x23, 0x4c, 0x94, 0x31, 0x4d, 0x9b, 0x86, 0x14, 0xbb, 0x1f,
+	0x63, 0x9f, 0x1d, 0x7d, 0x4e, 0x89, 0xde, 0xc3, 0xe7, 0x10, 0xfe, 0xe0, 0x29, 0x8d, 0x32, 0x56,
+	0x24, 0xc2, 0x1f, 0x17, 0x4b, 0x48, 0x86, 0x89, 0x17, 0x99, 0x0d, 0x32, 0xbf, 0x83, 0xc9, 0x51,
+	0xaa, 0x03, 0x76, 0x97, 0xf2, 0x5c, 0x0f, 0xde, 0x83, 0x37, 0x96, 0x2f, 0x61, 0x76, 0x55, 0xf0,
+	0xff, 0x35, 0xf3, 0x27, 0x88, 0x7b, 0xc6, 0xd7, 0x29, 0xe9, 0xa8, 0x2e, 0x10, 0xfe, 0x48, 0x8c,
+	0xae, 0xa8, 0xcc, 0x33, 0xba, 0xca, 0x37, 0x00, 0xb4, 0xfe, 0xca, 0x1c, 0xd1, 0xf2, 0x07, 0x48,
+	0xf6, 0xa8, 0xd4, 0x41, 0xd7, 0x46, 0x53, 0x51, 0x24, 0x46, 0x82, 0x2f, 0x60, 0xda, 0x8d, 0x45,
+	0x5b, 0x1b, 0x4b, 0x8f, 0x18, 0x89, 0x01, 0x7f, 0xc5, 0xf4, 0x51, 0x2f, 0x7f, 0x36, 0x00, 0x3d,
+	0x0f, 0xba, 0x01, 0x00, 0x00,
 }
@@ -3,21 +3,69 @@ package regionagogo
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"strconv"
 
 	"github.com/akhenakh/regionagogo/geostore"
 	"github.com/golang/geo/s2"
 	"github.com/kpawlik/geojson"
 )
 
+// Format is the input format of an Import
+type Format int
+
+const (
+	// FormatGeoJSON is a GeoJSON FeatureCollection or a single Feature
+	FormatGeoJSON Format = iota
+
+	// FormatGeoJSONSeq is one GeoJSON Feature per record, RFC 8142 GeoJSON Text Sequences
+	// with records prefixed by the RS character, or newline delimited JSON
+	FormatGeoJSONSeq
+
+	// FormatShapefile is an Esri shapefile of polygons, the .shp shapes and their .dbf attributes
+	FormatShapefile
+
+	// FormatKML is a KML document, its placemarks polygons with their name and extended data
+	FormatKML
+
+	// FormatCSV is a CSV with a header and a WKT or hex encoded WKB geometry column
+	FormatCSV
+)
+
 type Import struct {
 	gs            GeoFenceDB
 	r             io.Reader
+	dbf           io.Reader
+	geometryCol   string
 	importFields  []string
 	forceFields   map[string]string
 	renameFields  map[string]string
 	FeatureImport bool
+	// Format is the input format, FormatGeoJSON by default
+	Format Format
+	// KeyField is the property used as the fence key, leave empty for no key
+	KeyField string
+	// Coverer are the settings used to cover the fences, DefaultCovererSettings by default
+	Coverer CovererSettings
+	// CoverReport receives one tab separated line per imported fence with its coverings sizes and levels
+	CoverReport io.Writer
+	// BatchSize is the number of fences stored per transaction when the db supports it
+	BatchSize int
+	// Progress is called after each stored batch with the fences count and the bytes read so far
+	Progress func(fences int, bytesRead int64)
+}
+
+// defaultBatchSize is the number of fences stored per transaction by default
+const defaultBatchSize = 1000
+
+// ErrInvalidGeoJSON is returned when the import input is not a GeoJSON FeatureCollection or Feature
+var ErrInvalidGeoJSON = errors.New("invalid GeoJSON, expecting a FeatureCollection or a Feature")
+
+// fenceBatchStorer is implemented by the GeoFenceDB storing several fences in one transaction
+type fenceBatchStorer interface {
+	StoreFences(fss []*geostore.FenceStorage, fcs []*geostore.FenceCover) error
 }
 
 // ImportGeoJSONFile will load a geo json and save the polygons into
@@ -33,119 +81,402 @@ func NewGeoJSONImport(gs GeoFenceDB, r io.Reader, importFields []string, forceFi
 		importFields: importFields,
 		forceFields:  forceFields,
 		renameFields: renameFields,
+		Coverer:      DefaultCovererSettings,
+		BatchSize:    defaultBatchSize,
 	}
 
 	return &i
 }
 
+// NewShapefileImport returns an Import of the polygons read from the .shp shp
+// with their attributes read from the .dbf dbf, dbf can be nil to import the shapes only
+// importFields, forceFields and renameFields apply to the dbf columns as NewGeoJSONImport to the properties
+func NewShapefileImport(gs GeoFenceDB, shp, dbf io.Reader, importFields []string, forceFields map[string]string, renameFields map[string]string) *Import {
+	i := NewGeoJSONImport(gs, shp, importFields, forceFields, renameFields)
+	i.dbf = dbf
+	i.Format = FormatShapefile
+
+	return i
+}
+
+// NewKMLImport returns an Import of the placemarks read from the KML document r,
+// use KMZDocument to read a KMZ archive, the placemarks name and extended data are the properties
+// importFields, forceFields and renameFields apply to them as NewGeoJSONImport to the GeoJSON properties
+func NewKMLImport(gs GeoFenceDB, r io.Reader, importFields []string, forceFields map[string]string, renameFields map[string]string) *Import {
+	i := NewGeoJSONImport(gs, r, importFields, forceFields, renameFields)
+	i.Format = FormatKML
+
+	return i
+}
+
+// NewCSVImport returns an Import of the rows read from the CSV r, its first row is the header,
+// geometryColumn is the column of the WKT or hex encoded WKB geometries, the other columns are the properties
+// importFields, forceFields and renameFields apply to them as NewGeoJSONImport to the GeoJSON properties
+func NewCSVImport(gs GeoFenceDB, r io.Reader, geometryColumn string, importFields []string, forceFields map[string]string, renameFields map[string]string) *Import {
+	i := NewGeoJSONImport(gs, r, importFields, forceFields, renameFields)
+	i.geometryCol = geometryColumn
+	i.Format = FormatCSV
+
+	return i
+}
+
+// Start imports the features, they are decoded and stored one batch at a time
+// so the memory used does not depend on the input size
 func (i *Import) Start() error {
-	var geo geojson.FeatureCollection
+	cr := &countingReader{r: i.r}
+
+	switch i.Format {
+	case FormatGeoJSONSeq:
+		return i.importFeatures(cr, func(fn func(*geojson.Feature) error) error {
+			return streamFeatureSeq(cr, fn)
+		})
+	case FormatShapefile:
+		return i.importFeatures(cr, func(fn func(*geojson.Feature) error) error {
+			return streamShapefile(cr, i.dbf, fn)
+		})
+	case FormatKML:
+		return i.importFeatures(cr, func(fn func(*geojson.Feature) error) error {
+			return streamKML(cr, fn)
+		})
+	case FormatCSV:
+		return i.importFeatures(cr, func(fn func(*geojson.Feature) error) error {
+			return streamCSV(cr, i.geometryCol, fn)
+		})
+	}
 
-	if i.FeatureImport {
-		var f geojson.Feature
-		d := json.NewDecoder(i.r)
+	d := json.NewDecoder(cr)
 
-		if err := d.Decode(&f); err != nil {
-			return err
+	return i.importFeatures(cr, func(fn func(*geojson.Feature) error) error {
+		if i.FeatureImport {
+			var f geojson.Feature
+			if err := d.Decode(&f); err != nil {
+				return err
+			}
+			return fn(&f)
 		}
-		geo.AddFeatures(&f)
-	} else {
-		d := json.NewDecoder(i.r)
 
-		if err := d.Decode(&geo); err != nil {
-			return err
+		return streamFeatures(d, fn)
+	})
+}
+
+// importFeatures stores the features produced by each in batches, cr counts the bytes read for the progress
+func (i *Import) importFeatures(cr *countingReader, each func(fn func(*geojson.Feature) error) error) error {
+	if i.CoverReport != nil {
+		fmt.Fprintln(i.CoverReport, "feature\tkey\tcells\tmin_level\tmax_level\tinterior_cells\tinterior_min_level\tinterior_max_level")
+	}
+
+	batchSize := i.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	var fss []*geostore.FenceStorage
+	var fcs []*geostore.FenceCover
+	var count, n, cells, interiorCells int
+
+	flush := func() error {
+		if len(fss) == 0 {
+			return nil
+		}
+
+		if bs, ok := i.gs.(fenceBatchStorer); ok {
+			if err := bs.StoreFences(fss, fcs); err != nil {
+				return err
+			}
+		} else {
+			for j := range fss {
+				if err := i.gs.StoreFence(fss[j], fcs[j]); err != nil {
+					return err
+				}
+			}
+		}
+
+		count += len(fss)
+		fss, fcs = fss[:0], fcs[:0]
+
+		if i.Progress != nil {
+			i.Progress(count, cr.n)
 		}
+		return nil
 	}
 
-	var count int
+	err := each(func(f *geojson.Feature) error {
+		defer func() { n++ }()
 
-	if len(geo.Features) == 0 {
-		// try a feature geojson
-		var feat geojson.Feature
-		d := json.NewDecoder(i.r)
-		if err := d.Decode(&feat); err != nil {
+		polygons, err := featurePolygons(f)
+		if err != nil {
 			return err
 		}
-		geo.AddFeatures(&feat)
+
+		rc, fc := i.prepareFence(f, polygons)
+		if rc == nil {
+			return nil
+		}
+
+		ext, in := NewCoverStats(fc.Cellunion), NewCoverStats(fc.Interior)
+		cells += ext.Cells
+		interiorCells += in.Cells
+		if i.CoverReport != nil {
+			fmt.Fprintf(i.CoverReport, "%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\n",
+				n, rc.Key, ext.Cells, ext.MinLevel, ext.MaxLevel, in.Cells, in.MinLevel, in.MaxLevel)
+		}
+
+		fss = append(fss, rc)
+		fcs = append(fcs, fc)
+		if len(fss) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	log.Println(count, "new fences imported,", cells, "cells", interiorCells, "interior cells")
+
+	return nil
+}
+
+// streamFeatures decodes a GeoJSON FeatureCollection calling fn for each feature,
+// features are decoded one at a time, the collection is never loaded in memory
+// a single GeoJSON Feature is also accepted
+func streamFeatures(d *json.Decoder, fn func(*geojson.Feature) error) error {
+	if err := expectDelim(d, '{'); err != nil {
+		return err
 	}
 
-	for _, f := range geo.Features {
-		geom, err := f.GetGeometry()
+	// members other than features, to read back a single Feature
+	members := make(map[string]json.RawMessage)
+	var collection bool
+
+	for d.More() {
+		t, err := d.Token()
 		if err != nil {
 			return err
 		}
+		key, ok := t.(string)
+		if !ok {
+			return ErrInvalidGeoJSON
+		}
 
-		switch geom.GetType() {
-		case "Polygon":
-			mp := geom.(*geojson.Polygon)
-			for _, p := range mp.Coordinates {
-				rc, cu := preparePolygon(f, p, i.importFields, i.forceFields, i.renameFields)
-				if rc != nil {
-					if err := i.gs.StoreFence(rc, cu); err != nil {
-						return err
-					}
-					count++
-				}
+		if key != "features" {
+			var raw json.RawMessage
+			if err := d.Decode(&raw); err != nil {
+				return err
 			}
-		case "MultiPolygon":
-			mp := geom.(*geojson.MultiPolygon)
-			// multipolygon
-			for _, m := range mp.Coordinates {
-				// coordinates polygon
-				p := m[0]
-
-				rc, cu := preparePolygon(f, p, i.importFields, i.forceFields, i.renameFields)
-				if rc != nil {
-					if err := i.gs.StoreFence(rc, cu); err != nil {
-						return err
-					}
-					count++
-				}
+			members[key] = raw
+			continue
+		}
+
+		collection = true
+		if err := expectDelim(d, '['); err != nil {
+			return err
+		}
+		for d.More() {
+			var f geojson.Feature
+			if err := d.Decode(&f); err != nil {
+				return err
 			}
-		default:
-			return errors.New("unknown type")
+			if err := fn(&f); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(d, ']'); err != nil {
+			return err
 		}
 	}
 
-	log.Println(count, "new fences imported")
+	if err := expectDelim(d, '}'); err != nil {
+		return err
+	}
 
+	if collection {
+		return nil
+	}
+
+	var typ string
+	if err := json.Unmarshal(members["type"], &typ); err != nil || typ != "Feature" {
+		return ErrInvalidGeoJSON
+	}
+
+	buf, err := json.Marshal(members)
+	if err != nil {
+		return err
+	}
+	var f geojson.Feature
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return err
+	}
+	return fn(&f)
+}
+
+// streamFeatureSeq decodes a GeoJSON text sequence or newline delimited JSON calling fn for each feature
+func streamFeatureSeq(r io.Reader, fn func(*geojson.Feature) error) error {
+	// the record separators are dropped, JSON texts are decoded one after the other
+	// whatever the whitespace between them
+	d := json.NewDecoder(rsStripper{r: r})
+	for {
+		var f geojson.Feature
+		err := d.Decode(&f)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+}
+
+// recordSeparator prefixes each record of a GeoJSON text sequence
+const recordSeparator = 0x1e
+
+// rsStripper removes the record separators read from r,
+// they can't be part of a JSON text where control characters must be escaped
+type rsStripper struct {
+	r io.Reader
+}
+
+func (rs rsStripper) Read(p []byte) (int, error) {
+	n, err := rs.r.Read(p)
+	j := 0
+	for _, b := range p[:n] {
+		if b != recordSeparator {
+			p[j] = b
+			j++
+		}
+	}
+	return j, err
+}
+
+// expectDelim reads the next token, returns ErrInvalidGeoJSON if it is not delim
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return ErrInvalidGeoJSON
+	}
 	return nil
 }
 
-// preparePolygon transform a geojson polygons into FenceStorage
-func preparePolygon(f *geojson.Feature, p geojson.Coordinates, importFields []string, forceFields map[string]string, renameFields map[string]string) (*geostore.FenceStorage, []uint64) {
-	if isClockwisePolygon(p) {
-		reversePolygon(p)
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// PrepareFeature transforms a GeoJSON feature into a FenceStorage and its cover
+// the same way Start does, ready to be stored with StoreFence or UpdateFence
+// ErrInvalidFence is returned for a feature which is not a valid Polygon or MultiPolygon
+func (i *Import) PrepareFeature(f *geojson.Feature) (*geostore.FenceStorage, *geostore.FenceCover, error) {
+	polygons, err := featurePolygons(f)
+	if err != nil {
+		return nil, nil, ErrInvalidFence
 	}
 
-	// polygon
-	// do not add last point in storage (first point is last point)
-	points := make([]s2.Point, len(p)-1)
+	rc, fc := i.prepareFence(f, polygons)
+	if rc == nil {
+		return nil, nil, ErrInvalidFence
+	}
+
+	return rc, fc, nil
+}
+
+// featurePolygons returns the polygons of a Polygon or MultiPolygon feature
+func featurePolygons(f *geojson.Feature) ([]geojson.MultiLine, error) {
+	// features read from other formats than GeoJSON carry their geometry already decoded
+	switch geom := f.Geometry.(type) {
+	case *geojson.Polygon:
+		return []geojson.MultiLine{geom.Coordinates}, nil
+	case *geojson.MultiPolygon:
+		return geom.Coordinates, nil
+	}
 
+	geom, err := f.GetGeometry()
+	if err != nil {
+		return nil, err
+	}
+
+	switch geom.GetType() {
+	case "Polygon":
+		mp := geom.(*geojson.Polygon)
+		return []geojson.MultiLine{mp.Coordinates}, nil
+	case "MultiPolygon":
+		mp := geom.(*geojson.MultiPolygon)
+		// multipolygon parts are kept together as one fence
+		return mp.Coordinates, nil
+	default:
+		return nil, errors.New("unknown type")
+	}
+}
+
+// prepareFence transforms geojson polygons into one FenceStorage
+// for each polygon the first ring is the exterior ring, any others are interior rings or holes
+func (i *Import) prepareFence(f *geojson.Feature, polygons []geojson.MultiLine) (*geostore.FenceStorage, *geostore.FenceCover) {
 	// For type "MultiPolygon", the "coordinates" member must be an array of Polygon coordinate arrays.
 	// "Polygon", the "coordinates" member must be an array of LinearRing coordinate arrays.
 	// For Polygons with multiple rings, the first must be the exterior ring and any others must be interior rings or holes.
+	var loops, storedLoops []*s2.Loop
+	var lss []*geostore.LoopStorage
+
+	for _, rings := range polygons {
+		for ri, p := range rings {
+			l := loopFromRing(p)
+			if l == nil {
+				if ri == 0 {
+					// skip this polygon and its holes
+					log.Println("invalid loop", f.Properties)
+					break
+				}
+				log.Println("invalid hole", f.Properties)
+				continue
+			}
 
-	for i := 0; i < len(p)-1; i++ {
-		ll := s2.LatLngFromDegrees(float64(p[i][1]), float64(p[i][0]))
-		points[i] = s2.PointFromLatLng(ll)
-	}
+			var cpoints []*geostore.CPoint
 
-	l := s2.LoopFromPoints(points)
+			for _, v := range l.Vertices() {
+				ll := s2.LatLngFromPoint(v)
+				cpoints = append(cpoints, &geostore.CPoint{Lat: float32(ll.Lat.Degrees()), Lng: float32(ll.Lng.Degrees())})
+			}
 
-	if l.IsEmpty() || l.IsFull() || l.ContainsOrigin() {
+			loops = append(loops, l)
+			storedLoops = append(storedLoops, loopFromStorage(cpoints))
+			lss = append(lss, &geostore.LoopStorage{Points: cpoints})
+		}
+	}
+
+	if len(loops) == 0 {
 		log.Println("invalid loop", f.Properties)
 		return nil, nil
 	}
 
-	covering := defaultCoverer.Covering(l)
+	coverer := i.Coverer.Coverer()
+	covering := coverer.Covering(s2.PolygonFromLoops(loops))
+
+	// the interior covering is computed on the stored, less precise, loops
+	// so a point in an interior cell is always inside the fence read back from storage
+	interior := coverer.InteriorCovering(s2.PolygonFromLoops(storedLoops))
 
 	data := make(map[string]string)
-	for _, field := range importFields {
+	for _, field := range i.importFields {
 		if v, ok := f.Properties[field].(string); !ok {
 			log.Println("can't find field on", f.Properties)
 		} else {
-			if renamedKey, ok := renameFields[field]; ok {
+			if renamedKey, ok := i.renameFields[field]; ok {
 				data[renamedKey] = v
 			} else {
 				data[field] = v
@@ -153,34 +484,81 @@ func preparePolygon(f *geojson.Feature, p geojson.Coordinates, importFields []st
 		}
 	}
 
-	for k, v := range forceFields {
+	for k, v := range i.forceFields {
 		data[k] = v
 	}
 
-	cu := make([]uint64, len(covering))
-	var invalidLoop bool
+	fc := &geostore.FenceCover{
+		Cellunion: make([]uint64, len(covering)),
+		Interior:  make([]uint64, len(interior)),
+	}
 
 	for i, v := range covering {
-		cu[i] = uint64(v)
+		fc.Cellunion[i] = uint64(v)
 	}
 
-	// do not insert big loop
-	if invalidLoop {
-		return nil, nil
+	for i, v := range interior {
+		fc.Interior[i] = uint64(v)
 	}
 
-	var cpoints []*geostore.CPoint
+	rs := &geostore.FenceStorage{
+		Loops: lss,
+		Data:  data,
+	}
 
-	for _, p := range points {
-		ll := s2.LatLngFromPoint(p)
-		cpoints = append(cpoints, &geostore.CPoint{Lat: float32(ll.Lat.Degrees()), Lng: float32(ll.Lng.Degrees())})
+	if i.KeyField != "" {
+		key, ok := propertyString(f.Properties[i.KeyField])
+		if !ok {
+			log.Println("can't find key field on", f.Properties)
+			return nil, nil
+		}
+		rs.Key = key
 	}
 
-	rs := &geostore.FenceStorage{
-		Points: cpoints,
-		Data:   data,
+	return rs, fc
+}
+
+// propertyString returns a GeoJSON property string or number as a string
+func propertyString(v interface{}) (string, bool) {
+	switch tv := v.(type) {
+	case string:
+		return tv, tv != ""
+	case float64:
+		// numeric ids like whosonfirst ids are decoded as float64
+		return strconv.FormatFloat(tv, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// loopFromRing transforms a GeoJSON linear ring into a counter clockwise s2 loop
+// returns nil for an invalid ring
+func loopFromRing(p geojson.Coordinates) *s2.Loop {
+	// a linear ring is at least 3 points plus the closing point
+	if len(p) < 4 {
+		return nil
+	}
+
+	// s2 expects every loops, holes included, to be counter clockwise
+	if isClockwisePolygon(p) {
+		reversePolygon(p)
 	}
-	return rs, cu
+
+	// do not add last point in storage (first point is last point)
+	points := make([]s2.Point, len(p)-1)
+
+	for i := 0; i < len(p)-1; i++ {
+		ll := s2.LatLngFromDegrees(float64(p[i][1]), float64(p[i][0]))
+		points[i] = s2.PointFromLatLng(ll)
+	}
+
+	l := s2.LoopFromPoints(points)
+
+	if l.IsEmpty() || l.IsFull() || l.ContainsOrigin() {
+		return nil
+	}
+
+	return l
 }
 
 func isClockwisePolygon(p geojson.Coordinates) bool {
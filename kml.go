@@ -0,0 +1,210 @@
+package regionagogo
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/kpawlik/geojson"
+)
+
+var (
+	// ErrInvalidKML is returned when the KML is not a kml document or its coordinates are malformed
+	ErrInvalidKML = errors.New("invalid KML")
+
+	// ErrInvalidKMZ is returned when a KMZ archive does not contain a KML document
+	ErrInvalidKMZ = errors.New("invalid KMZ, no KML document")
+)
+
+// kmlPlacemark is a KML Placemark, only its name, its extended data and its polygons are read
+type kmlPlacemark struct {
+	Name         string `xml:"name"`
+	ExtendedData struct {
+		Data []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value"`
+		} `xml:"Data"`
+		SchemaData []struct {
+			SimpleData []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"SimpleData"`
+		} `xml:"SchemaData"`
+	} `xml:"ExtendedData"`
+	Polygons      []kmlPolygon       `xml:"Polygon"`
+	MultiGeometry []kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+// kmlMultiGeometry is a KML MultiGeometry, it can be nested, geometries other than polygons are ignored
+type kmlMultiGeometry struct {
+	Polygons      []kmlPolygon       `xml:"Polygon"`
+	MultiGeometry []kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+// kmlPolygon is a KML Polygon, its outer and inner boundaries coordinates
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// properties returns the placemark name and extended data as GeoJSON properties
+func (p *kmlPlacemark) properties() map[string]interface{} {
+	properties := make(map[string]interface{})
+	if name := strings.TrimSpace(p.Name); name != "" {
+		properties["name"] = name
+	}
+	for _, d := range p.ExtendedData.Data {
+		properties[d.Name] = strings.TrimSpace(d.Value)
+	}
+	for _, sd := range p.ExtendedData.SchemaData {
+		for _, d := range sd.SimpleData {
+			properties[d.Name] = strings.TrimSpace(d.Value)
+		}
+	}
+	return properties
+}
+
+// polygons returns all the placemark polygons, nested MultiGeometry included
+func (p *kmlPlacemark) polygons() ([]geojson.MultiLine, error) {
+	polygons := p.Polygons
+	var walk func(mgs []kmlMultiGeometry)
+	walk = func(mgs []kmlMultiGeometry) {
+		for _, mg := range mgs {
+			polygons = append(polygons, mg.Polygons...)
+			walk(mg.MultiGeometry)
+		}
+	}
+	walk(p.MultiGeometry)
+
+	var res []geojson.MultiLine
+	for _, kp := range polygons {
+		outer, err := kmlRing(kp.Outer)
+		if err != nil {
+			return nil, err
+		}
+		rings := geojson.MultiLine{outer}
+		for _, in := range kp.Inner {
+			inner, err := kmlRing(in)
+			if err != nil {
+				return nil, err
+			}
+			rings = append(rings, inner)
+		}
+		res = append(res, rings)
+	}
+	return res, nil
+}
+
+// kmlRing parses KML coordinates, lng,lat[,alt] tuples separated by whitespaces, into a closed ring
+func kmlRing(coordinates string) (geojson.Coordinates, error) {
+	var ring geojson.Coordinates
+	for _, tuple := range strings.Fields(coordinates) {
+		values := strings.Split(tuple, ",")
+		if len(values) < 2 {
+			return nil, ErrInvalidKML
+		}
+		lng, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, ErrInvalidKML
+		}
+		lat, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return nil, ErrInvalidKML
+		}
+		if !validLngLat(lng, lat) {
+			return nil, ErrOutOfRangeCoordinates
+		}
+		ring = append(ring, geojson.Coordinate{geojson.CoordType(lng), geojson.CoordType(lat)})
+	}
+
+	// rings must be closed but some tools omit the closing point
+	if len(ring) > 1 && !closedRing(ring) {
+		ring = append(ring, ring[0])
+	}
+	return ring, nil
+}
+
+// streamKML decodes the placemarks of a KML document calling fn for each placemark with polygons,
+// placemarks are decoded one at a time wherever they are in the documents and folders tree
+func streamKML(r io.Reader, fn func(*geojson.Feature) error) error {
+	d := xml.NewDecoder(r)
+
+	var root bool
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			if !root {
+				return ErrInvalidKML
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !root {
+			if se.Name.Local != "kml" {
+				return ErrInvalidKML
+			}
+			root = true
+			continue
+		}
+		if se.Name.Local != "Placemark" {
+			continue
+		}
+
+		var p kmlPlacemark
+		if err := d.DecodeElement(&p, &se); err != nil {
+			return err
+		}
+
+		polygons, err := p.polygons()
+		if err != nil {
+			return err
+		}
+		properties := p.properties()
+		if len(polygons) == 0 {
+			log.Println("placemark without polygon", properties)
+			continue
+		}
+
+		f := &geojson.Feature{
+			Type:       "Feature",
+			Geometry:   &geojson.MultiPolygon{Type: "MultiPolygon", Coordinates: polygons},
+			Properties: properties,
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// KMZDocument returns the KML document of a KMZ archive, the first .kml file at its root
+// or, when there is none, the first .kml file found
+func KMZDocument(zr *zip.Reader) (*zip.File, error) {
+	var doc *zip.File
+	for _, f := range zr.File {
+		if strings.ToLower(path.Ext(f.Name)) != ".kml" {
+			continue
+		}
+		if !strings.Contains(f.Name, "/") {
+			return f, nil
+		}
+		if doc == nil {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return nil, ErrInvalidKMZ
+	}
+	return doc, nil
+}
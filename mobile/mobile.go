@@ -27,6 +27,8 @@ func NewFence() *Fence {
 	return f
 }
 
+// OpenDB opens the db at path read only, a db built by ragogenfromjson
+// is queried through its persisted index without loading the covers in memory
 func (gf *GeoDB) OpenDB(path string) error {
 	opts := []boltdb.GeoFenceBoltDBOption{
 		boltdb.WithCachedEntries(20),
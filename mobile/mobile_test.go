@@ -1,8 +1,14 @@
 package mobile
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/akhenakh/regionagogo"
+	"github.com/akhenakh/regionagogo/db/boltdb"
 	"github.com/stretchr/testify/require"
 )
 
@@ -15,3 +21,31 @@ func TestStorage(t *testing.T) {
 	f := db.QueryHandler(47.01492366313195, -70.842592064976714)
 	require.NotNil(t, f)
 }
+
+func TestPersistedIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "testmobile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "region.db")
+
+	// built like ragogenfromjson does
+	gs, err := boltdb.NewGeoFenceBoltDB(path)
+	require.NoError(t, err)
+	r := strings.NewReader(`{"type":"Feature","properties":{"name":"square","iso_a2":"SQ"},"geometry":{"type":"Polygon","coordinates":[[[-1,-1],[1,-1],[1,1],[-1,1],[-1,-1]]]}}`)
+	i := regionagogo.NewGeoJSONImport(gs, r, []string{"name", "iso_a2"}, nil, nil)
+	i.FeatureImport = true
+	require.NoError(t, i.Start())
+	require.NoError(t, gs.BuildIndex())
+	require.NoError(t, gs.Close())
+
+	db := NewGeoDB()
+	err = db.OpenDB(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	f := db.QueryHandler(0.5, 0.5)
+	require.NotNil(t, f)
+	require.Equal(t, "square", f.Name)
+	require.Equal(t, "SQ", f.Iso)
+	require.Nil(t, db.QueryHandler(5, 5))
+}
@@ -9,7 +9,22 @@ It is generated from these files:
 
 It has these top-level messages:
 	Point
+	Points
 	RegionResponse
+	RegionsResponse
+	FenceKeyRequest
+	NearestRequest
+	Fence
+	FencesResponse
+	FencesRequest
+	Loop
+	FenceIDRequest
+	RectRequest
+	RadiusRequest
+	AddFencesRequest
+	FenceRef
+	ReplaceFenceRequest
+	AdminResponse
 */
 package regionagogosvc
 
@@ -33,9 +48,41 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+// Relation is the spatial predicate tested between a query region and the fences
+type Relation int32
+
+const (
+	// fast but approximate, for a radius the fences whose cover touches the circle cover,
+	// for a rect the fences whose bounding rect is inside the rect
+	Relation_APPROXIMATE Relation = 0
+	Relation_INTERSECTS  Relation = 1
+	Relation_WITHIN      Relation = 2
+	Relation_CONTAINS    Relation = 3
+)
+
+var Relation_name = map[int32]string{
+	0: "APPROXIMATE",
+	1: "INTERSECTS",
+	2: "WITHIN",
+	3: "CONTAINS",
+}
+var Relation_value = map[string]int32{
+	"APPROXIMATE": 0,
+	"INTERSECTS":  1,
+	"WITHIN":      2,
+	"CONTAINS":    3,
+}
+
+func (x Relation) String() string {
+	return proto.EnumName(Relation_name, int32(x))
+}
+func (Relation) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
 type Point struct {
 	Latitude  float32 `protobuf:"fixed32,1,opt,name=latitude" json:"latitude,omitempty"`
 	Longitude float32 `protobuf:"fixed32,2,opt,name=longitude" json:"longitude,omitempty"`
+	// client assigned id, echoed in the response of a stream
+	Id uint64 `protobuf:"varint,3,opt,name=id" json:"id,omitempty"`
 }
 
 func (m *Point) Reset()                    { *m = Point{} }
@@ -57,14 +104,39 @@ func (m *Point) GetLongitude() float32 {
 	return 0
 }
 
+func (m *Point) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+type Points struct {
+	Points []*Point `protobuf:"bytes,1,rep,name=points" json:"points,omitempty"`
+}
+
+func (m *Points) Reset()                    { *m = Points{} }
+func (m *Points) String() string            { return proto.CompactTextString(m) }
+func (*Points) ProtoMessage()               {}
+func (*Points) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Points) GetPoints() []*Point {
+	if m != nil {
+		return m.Points
+	}
+	return nil
+}
+
 type RegionResponse struct {
 	Code string `protobuf:"bytes,1,opt,name=code" json:"code,omitempty"`
+	// id of the queried point
+	Id uint64 `protobuf:"varint,2,opt,name=id" json:"id,omitempty"`
 }
 
 func (m *RegionResponse) Reset()                    { *m = RegionResponse{} }
 func (m *RegionResponse) String() string            { return proto.CompactTextString(m) }
 func (*RegionResponse) ProtoMessage()               {}
-func (*RegionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (*RegionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
 
 func (m *RegionResponse) GetCode() string {
 	if m != nil {
@@ -73,9 +145,450 @@ func (m *RegionResponse) GetCode() string {
 	return ""
 }
 
+func (m *RegionResponse) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+type RegionsResponse struct {
+	Regions []*RegionResponse `protobuf:"bytes,1,rep,name=regions" json:"regions,omitempty"`
+}
+
+func (m *RegionsResponse) Reset()                    { *m = RegionsResponse{} }
+func (m *RegionsResponse) String() string            { return proto.CompactTextString(m) }
+func (*RegionsResponse) ProtoMessage()               {}
+func (*RegionsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *RegionsResponse) GetRegions() []*RegionResponse {
+	if m != nil {
+		return m.Regions
+	}
+	return nil
+}
+
+type FenceKeyRequest struct {
+	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	// returns the geometry of the fence
+	Geometry bool `protobuf:"varint,2,opt,name=geometry" json:"geometry,omitempty"`
+}
+
+func (m *FenceKeyRequest) Reset()                    { *m = FenceKeyRequest{} }
+func (m *FenceKeyRequest) String() string            { return proto.CompactTextString(m) }
+func (*FenceKeyRequest) ProtoMessage()               {}
+func (*FenceKeyRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *FenceKeyRequest) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *FenceKeyRequest) GetGeometry() bool {
+	if m != nil {
+		return m.Geometry
+	}
+	return false
+}
+
+type NearestRequest struct {
+	Latitude  float32 `protobuf:"fixed32,1,opt,name=latitude" json:"latitude,omitempty"`
+	Longitude float32 `protobuf:"fixed32,2,opt,name=longitude" json:"longitude,omitempty"`
+	// number of fences to return, at least 1
+	K uint32 `protobuf:"varint,3,opt,name=k" json:"k,omitempty"`
+	// maximum distance in meters, 0 for no limit
+	MaxDistance float64 `protobuf:"fixed64,4,opt,name=max_distance,json=maxDistance" json:"max_distance,omitempty"`
+}
+
+func (m *NearestRequest) Reset()                    { *m = NearestRequest{} }
+func (m *NearestRequest) String() string            { return proto.CompactTextString(m) }
+func (*NearestRequest) ProtoMessage()               {}
+func (*NearestRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *NearestRequest) GetLatitude() float32 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *NearestRequest) GetLongitude() float32 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *NearestRequest) GetK() uint32 {
+	if m != nil {
+		return m.K
+	}
+	return 0
+}
+
+func (m *NearestRequest) GetMaxDistance() float64 {
+	if m != nil {
+		return m.MaxDistance
+	}
+	return 0
+}
+
+// Fence is a fence and its metadata
+type Fence struct {
+	Id   uint64            `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Key  string            `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	Data map[string]string `protobuf:"bytes,3,rep,name=data" json:"data,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// distance in meters from the queried position, 0 when inside
+	Distance float64 `protobuf:"fixed64,4,opt,name=distance" json:"distance,omitempty"`
+	// geometry of the fence, only set when asked, each exterior loop is followed by its holes
+	Loops []*Loop `protobuf:"bytes,5,rep,name=loops" json:"loops,omitempty"`
+}
+
+func (m *Fence) Reset()                    { *m = Fence{} }
+func (m *Fence) String() string            { return proto.CompactTextString(m) }
+func (*Fence) ProtoMessage()               {}
+func (*Fence) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Fence) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *Fence) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *Fence) GetData() map[string]string {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Fence) GetDistance() float64 {
+	if m != nil {
+		return m.Distance
+	}
+	return 0
+}
+
+func (m *Fence) GetLoops() []*Loop {
+	if m != nil {
+		return m.Loops
+	}
+	return nil
+}
+
+type FencesResponse struct {
+	Fences []*Fence `protobuf:"bytes,1,rep,name=fences" json:"fences,omitempty"`
+}
+
+func (m *FencesResponse) Reset()                    { *m = FencesResponse{} }
+func (m *FencesResponse) String() string            { return proto.CompactTextString(m) }
+func (*FencesResponse) ProtoMessage()               {}
+func (*FencesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *FencesResponse) GetFences() []*Fence {
+	if m != nil {
+		return m.Fences
+	}
+	return nil
+}
+
+type FencesRequest struct {
+	Latitude  float32 `protobuf:"fixed32,1,opt,name=latitude" json:"latitude,omitempty"`
+	Longitude float32 `protobuf:"fixed32,2,opt,name=longitude" json:"longitude,omitempty"`
+	// returns all the fences containing the position instead of the smallest one
+	MultipleFences bool `protobuf:"varint,3,opt,name=multiple_fences,json=multipleFences" json:"multiple_fences,omitempty"`
+	// returns the geometry of the fences
+	Geometry bool `protobuf:"varint,4,opt,name=geometry" json:"geometry,omitempty"`
+}
+
+func (m *FencesRequest) Reset()                    { *m = FencesRequest{} }
+func (m *FencesRequest) String() string            { return proto.CompactTextString(m) }
+func (*FencesRequest) ProtoMessage()               {}
+func (*FencesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *FencesRequest) GetLatitude() float32 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *FencesRequest) GetLongitude() float32 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *FencesRequest) GetMultipleFences() bool {
+	if m != nil {
+		return m.MultipleFences
+	}
+	return false
+}
+
+func (m *FencesRequest) GetGeometry() bool {
+	if m != nil {
+		return m.Geometry
+	}
+	return false
+}
+
+// Loop is a ring of counter clockwise vertices, the first vertex is not repeated
+type Loop struct {
+	Points []*Point `protobuf:"bytes,1,rep,name=points" json:"points,omitempty"`
+	// the loop is a hole in the previous exterior loop
+	Hole bool `protobuf:"varint,2,opt,name=hole" json:"hole,omitempty"`
+}
+
+func (m *Loop) Reset()                    { *m = Loop{} }
+func (m *Loop) String() string            { return proto.CompactTextString(m) }
+func (*Loop) ProtoMessage()               {}
+func (*Loop) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *Loop) GetPoints() []*Point {
+	if m != nil {
+		return m.Points
+	}
+	return nil
+}
+
+func (m *Loop) GetHole() bool {
+	if m != nil {
+		return m.Hole
+	}
+	return false
+}
+
+type FenceIDRequest struct {
+	Id uint64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	// returns the geometry of the fence
+	Geometry bool `protobuf:"varint,2,opt,name=geometry" json:"geometry,omitempty"`
+}
+
+func (m *FenceIDRequest) Reset()                    { *m = FenceIDRequest{} }
+func (m *FenceIDRequest) String() string            { return proto.CompactTextString(m) }
+func (*FenceIDRequest) ProtoMessage()               {}
+func (*FenceIDRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *FenceIDRequest) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *FenceIDRequest) GetGeometry() bool {
+	if m != nil {
+		return m.Geometry
+	}
+	return false
+}
+
+type RectRequest struct {
+	UpperRight *Point   `protobuf:"bytes,1,opt,name=upper_right,json=upperRight" json:"upper_right,omitempty"`
+	BottomLeft *Point   `protobuf:"bytes,2,opt,name=bottom_left,json=bottomLeft" json:"bottom_left,omitempty"`
+	Relation   Relation `protobuf:"varint,3,opt,name=relation,enum=regionagogosvc.Relation" json:"relation,omitempty"`
+	// returns the geometry of the fences
+	Geometry bool `protobuf:"varint,4,opt,name=geometry" json:"geometry,omitempty"`
+}
+
+func (m *RectRequest) Reset()                    { *m = RectRequest{} }
+func (m *RectRequest) String() string            { return proto.CompactTextString(m) }
+func (*RectRequest) ProtoMessage()               {}
+func (*RectRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *RectRequest) GetUpperRight() *Point {
+	if m != nil {
+		return m.UpperRight
+	}
+	return nil
+}
+
+func (m *RectRequest) GetBottomLeft() *Point {
+	if m != nil {
+		return m.BottomLeft
+	}
+	return nil
+}
+
+func (m *RectRequest) GetRelation() Relation {
+	if m != nil {
+		return m.Relation
+	}
+	return Relation_APPROXIMATE
+}
+
+func (m *RectRequest) GetGeometry() bool {
+	if m != nil {
+		return m.Geometry
+	}
+	return false
+}
+
+type RadiusRequest struct {
+	Latitude  float32 `protobuf:"fixed32,1,opt,name=latitude" json:"latitude,omitempty"`
+	Longitude float32 `protobuf:"fixed32,2,opt,name=longitude" json:"longitude,omitempty"`
+	// radius in meters
+	Radius   float64  `protobuf:"fixed64,3,opt,name=radius" json:"radius,omitempty"`
+	Relation Relation `protobuf:"varint,4,opt,name=relation,enum=regionagogosvc.Relation" json:"relation,omitempty"`
+	// returns the geometry of the fences
+	Geometry bool `protobuf:"varint,5,opt,name=geometry" json:"geometry,omitempty"`
+}
+
+func (m *RadiusRequest) Reset()                    { *m = RadiusRequest{} }
+func (m *RadiusRequest) String() string            { return proto.CompactTextString(m) }
+func (*RadiusRequest) ProtoMessage()               {}
+func (*RadiusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *RadiusRequest) GetLatitude() float32 {
+	if m != nil {
+		return m.Latitude
+	}
+	return 0
+}
+
+func (m *RadiusRequest) GetLongitude() float32 {
+	if m != nil {
+		return m.Longitude
+	}
+	return 0
+}
+
+func (m *RadiusRequest) GetRadius() float64 {
+	if m != nil {
+		return m.Radius
+	}
+	return 0
+}
+
+func (m *RadiusRequest) GetRelation() Relation {
+	if m != nil {
+		return m.Relation
+	}
+	return Relation_APPROXIMATE
+}
+
+func (m *RadiusRequest) GetGeometry() bool {
+	if m != nil {
+		return m.Geometry
+	}
+	return false
+}
+
+type AddFencesRequest struct {
+	// a GeoJSON Feature or FeatureCollection
+	Geojson string `protobuf:"bytes,1,opt,name=geojson" json:"geojson,omitempty"`
+}
+
+func (m *AddFencesRequest) Reset()                    { *m = AddFencesRequest{} }
+func (m *AddFencesRequest) String() string            { return proto.CompactTextString(m) }
+func (*AddFencesRequest) ProtoMessage()               {}
+func (*AddFencesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *AddFencesRequest) GetGeojson() string {
+	if m != nil {
+		return m.Geojson
+	}
+	return ""
+}
+
+// FenceRef references a fence by its id or, when id is 0, by its key
+type FenceRef struct {
+	Id  uint64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Key string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+}
+
+func (m *FenceRef) Reset()                    { *m = FenceRef{} }
+func (m *FenceRef) String() string            { return proto.CompactTextString(m) }
+func (*FenceRef) ProtoMessage()               {}
+func (*FenceRef) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *FenceRef) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *FenceRef) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+type ReplaceFenceRequest struct {
+	Fence *FenceRef `protobuf:"bytes,1,opt,name=fence" json:"fence,omitempty"`
+	// a GeoJSON Feature
+	Geojson string `protobuf:"bytes,2,opt,name=geojson" json:"geojson,omitempty"`
+}
+
+func (m *ReplaceFenceRequest) Reset()                    { *m = ReplaceFenceRequest{} }
+func (m *ReplaceFenceRequest) String() string            { return proto.CompactTextString(m) }
+func (*ReplaceFenceRequest) ProtoMessage()               {}
+func (*ReplaceFenceRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *ReplaceFenceRequest) GetFence() *FenceRef {
+	if m != nil {
+		return m.Fence
+	}
+	return nil
+}
+
+func (m *ReplaceFenceRequest) GetGeojson() string {
+	if m != nil {
+		return m.Geojson
+	}
+	return ""
+}
+
+type AdminResponse struct {
+	// number of fences stored, replaced or removed
+	Count uint32 `protobuf:"varint,1,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *AdminResponse) Reset()                    { *m = AdminResponse{} }
+func (m *AdminResponse) String() string            { return proto.CompactTextString(m) }
+func (*AdminResponse) ProtoMessage()               {}
+func (*AdminResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *AdminResponse) GetCount() uint32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Point)(nil), "regionagogosvc.Point")
+	proto.RegisterType((*Points)(nil), "regionagogosvc.Points")
 	proto.RegisterType((*RegionResponse)(nil), "regionagogosvc.RegionResponse")
+	proto.RegisterType((*RegionsResponse)(nil), "regionagogosvc.RegionsResponse")
+	proto.RegisterType((*FenceKeyRequest)(nil), "regionagogosvc.FenceKeyRequest")
+	proto.RegisterType((*NearestRequest)(nil), "regionagogosvc.NearestRequest")
+	proto.RegisterType((*Fence)(nil), "regionagogosvc.Fence")
+	proto.RegisterType((*FencesResponse)(nil), "regionagogosvc.FencesResponse")
+	proto.RegisterType((*FencesRequest)(nil), "regionagogosvc.FencesRequest")
+	proto.RegisterType((*Loop)(nil), "regionagogosvc.Loop")
+	proto.RegisterType((*FenceIDRequest)(nil), "regionagogosvc.FenceIDRequest")
+	proto.RegisterType((*RectRequest)(nil), "regionagogosvc.RectRequest")
+	proto.RegisterType((*RadiusRequest)(nil), "regionagogosvc.RadiusRequest")
+	proto.RegisterType((*AddFencesRequest)(nil), "regionagogosvc.AddFencesRequest")
+	proto.RegisterType((*FenceRef)(nil), "regionagogosvc.FenceRef")
+	proto.RegisterType((*ReplaceFenceRequest)(nil), "regionagogosvc.ReplaceFenceRequest")
+	proto.RegisterType((*AdminResponse)(nil), "regionagogosvc.AdminResponse")
+	proto.RegisterEnum("regionagogosvc.Relation", Relation_name, Relation_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -91,6 +604,23 @@ const _ = grpc.SupportPackageIsVersion4
 type RegionAGogoClient interface {
 	// Obtains the region at a given position.
 	GetRegion(ctx context.Context, in *Point, opts ...grpc.CallOption) (*RegionResponse, error)
+	// Obtains the fences at a given position with their metadata.
+	GetFences(ctx context.Context, in *FencesRequest, opts ...grpc.CallOption) (*FencesResponse, error)
+	// Obtains the regions of a batch of positions, in the same order.
+	GetRegions(ctx context.Context, in *Points, opts ...grpc.CallOption) (*RegionsResponse, error)
+	// Obtains the regions of a stream of positions, responses are sent in the same order
+	// and carry the id of their position.
+	StreamRegions(ctx context.Context, opts ...grpc.CallOption) (RegionAGogo_StreamRegionsClient, error)
+	// Obtains a fence by its user supplied key.
+	GetFenceByKey(ctx context.Context, in *FenceKeyRequest, opts ...grpc.CallOption) (*Fence, error)
+	// Obtains a fence by its id.
+	GetFenceByID(ctx context.Context, in *FenceIDRequest, opts ...grpc.CallOption) (*Fence, error)
+	// Obtains the fences related to a rectangle.
+	GetFencesInRect(ctx context.Context, in *RectRequest, opts ...grpc.CallOption) (*FencesResponse, error)
+	// Obtains the fences related to a circle around a position.
+	GetFencesInRadius(ctx context.Context, in *RadiusRequest, opts ...grpc.CallOption) (*FencesResponse, error)
+	// Obtains the nearest fences of a position and their distance.
+	GetNearestFences(ctx context.Context, in *NearestRequest, opts ...grpc.CallOption) (*FencesResponse, error)
 }
 
 type regionAGogoClient struct {
@@ -110,11 +640,122 @@ func (c *regionAGogoClient) GetRegion(ctx context.Context, in *Point, opts ...gr
 	return out, nil
 }
 
+func (c *regionAGogoClient) GetFences(ctx context.Context, in *FencesRequest, opts ...grpc.CallOption) (*FencesResponse, error) {
+	out := new(FencesResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetFences", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoClient) GetRegions(ctx context.Context, in *Points, opts ...grpc.CallOption) (*RegionsResponse, error) {
+	out := new(RegionsResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetRegions", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoClient) StreamRegions(ctx context.Context, opts ...grpc.CallOption) (RegionAGogo_StreamRegionsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RegionAGogo_serviceDesc.Streams[0], c.cc, "/regionagogosvc.RegionAGogo/StreamRegions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &regionAGogoStreamRegionsClient{stream}
+	return x, nil
+}
+
+type RegionAGogo_StreamRegionsClient interface {
+	Send(*Point) error
+	Recv() (*RegionResponse, error)
+	grpc.ClientStream
+}
+
+type regionAGogoStreamRegionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *regionAGogoStreamRegionsClient) Send(m *Point) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *regionAGogoStreamRegionsClient) Recv() (*RegionResponse, error) {
+	m := new(RegionResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *regionAGogoClient) GetFenceByKey(ctx context.Context, in *FenceKeyRequest, opts ...grpc.CallOption) (*Fence, error) {
+	out := new(Fence)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetFenceByKey", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoClient) GetFenceByID(ctx context.Context, in *FenceIDRequest, opts ...grpc.CallOption) (*Fence, error) {
+	out := new(Fence)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetFenceByID", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoClient) GetFencesInRect(ctx context.Context, in *RectRequest, opts ...grpc.CallOption) (*FencesResponse, error) {
+	out := new(FencesResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetFencesInRect", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoClient) GetFencesInRadius(ctx context.Context, in *RadiusRequest, opts ...grpc.CallOption) (*FencesResponse, error) {
+	out := new(FencesResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetFencesInRadius", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoClient) GetNearestFences(ctx context.Context, in *NearestRequest, opts ...grpc.CallOption) (*FencesResponse, error) {
+	out := new(FencesResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogo/GetNearestFences", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for RegionAGogo service
 
 type RegionAGogoServer interface {
 	// Obtains the region at a given position.
 	GetRegion(context.Context, *Point) (*RegionResponse, error)
+	// Obtains the fences at a given position with their metadata.
+	GetFences(context.Context, *FencesRequest) (*FencesResponse, error)
+	// Obtains the regions of a batch of positions, in the same order.
+	GetRegions(context.Context, *Points) (*RegionsResponse, error)
+	// Obtains the regions of a stream of positions, responses are sent in the same order
+	// and carry the id of their position.
+	StreamRegions(RegionAGogo_StreamRegionsServer) error
+	// Obtains a fence by its user supplied key.
+	GetFenceByKey(context.Context, *FenceKeyRequest) (*Fence, error)
+	// Obtains a fence by its id.
+	GetFenceByID(context.Context, *FenceIDRequest) (*Fence, error)
+	// Obtains the fences related to a rectangle.
+	GetFencesInRect(context.Context, *RectRequest) (*FencesResponse, error)
+	// Obtains the fences related to a circle around a position.
+	GetFencesInRadius(context.Context, *RadiusRequest) (*FencesResponse, error)
+	// Obtains the nearest fences of a position and their distance.
+	GetNearestFences(context.Context, *NearestRequest) (*FencesResponse, error)
 }
 
 func RegisterRegionAGogoServer(s *grpc.Server, srv RegionAGogoServer) {
@@ -139,6 +780,158 @@ func _RegionAGogo_GetRegion_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _RegionAGogo_GetFences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetFences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetFences",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetFences(ctx, req.(*FencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogo_GetRegions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Points)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetRegions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetRegions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetRegions(ctx, req.(*Points))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogo_StreamRegions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RegionAGogoServer).StreamRegions(&regionAGogoStreamRegionsServer{stream})
+}
+
+type RegionAGogo_StreamRegionsServer interface {
+	Send(*RegionResponse) error
+	Recv() (*Point, error)
+	grpc.ServerStream
+}
+
+type regionAGogoStreamRegionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *regionAGogoStreamRegionsServer) Send(m *RegionResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *regionAGogoStreamRegionsServer) Recv() (*Point, error) {
+	m := new(Point)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _RegionAGogo_GetFenceByKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FenceKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetFenceByKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetFenceByKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetFenceByKey(ctx, req.(*FenceKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogo_GetFenceByID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FenceIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetFenceByID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetFenceByID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetFenceByID(ctx, req.(*FenceIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogo_GetFencesInRect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetFencesInRect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetFencesInRect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetFencesInRect(ctx, req.(*RectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogo_GetFencesInRadius_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RadiusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetFencesInRadius(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetFencesInRadius",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetFencesInRadius(ctx, req.(*RadiusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogo_GetNearestFences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NearestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoServer).GetNearestFences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogo/GetNearestFences",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoServer).GetNearestFences(ctx, req.(*NearestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _RegionAGogo_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "regionagogosvc.RegionAGogo",
 	HandlerType: (*RegionAGogoServer)(nil),
@@ -147,6 +940,177 @@ var _RegionAGogo_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetRegion",
 			Handler:    _RegionAGogo_GetRegion_Handler,
 		},
+		{
+			MethodName: "GetFences",
+			Handler:    _RegionAGogo_GetFences_Handler,
+		},
+		{
+			MethodName: "GetRegions",
+			Handler:    _RegionAGogo_GetRegions_Handler,
+		},
+		{
+			MethodName: "GetFenceByKey",
+			Handler:    _RegionAGogo_GetFenceByKey_Handler,
+		},
+		{
+			MethodName: "GetFenceByID",
+			Handler:    _RegionAGogo_GetFenceByID_Handler,
+		},
+		{
+			MethodName: "GetFencesInRect",
+			Handler:    _RegionAGogo_GetFencesInRect_Handler,
+		},
+		{
+			MethodName: "GetFencesInRadius",
+			Handler:    _RegionAGogo_GetFencesInRadius_Handler,
+		},
+		{
+			MethodName: "GetNearestFences",
+			Handler:    _RegionAGogo_GetNearestFences_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRegions",
+			Handler:       _RegionAGogo_StreamRegions_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "regionagogosvc.proto",
+}
+
+// Client API for RegionAGogoAdmin service
+
+type RegionAGogoAdminClient interface {
+	// Stores the fences of a GeoJSON Feature or FeatureCollection.
+	AddFences(ctx context.Context, in *AddFencesRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	// Replaces a fence, referenced by its id or key, with a GeoJSON Feature.
+	ReplaceFence(ctx context.Context, in *ReplaceFenceRequest, opts ...grpc.CallOption) (*AdminResponse, error)
+	// Removes a fence referenced by its id or key.
+	RemoveFence(ctx context.Context, in *FenceRef, opts ...grpc.CallOption) (*AdminResponse, error)
+}
+
+type regionAGogoAdminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRegionAGogoAdminClient(cc *grpc.ClientConn) RegionAGogoAdminClient {
+	return &regionAGogoAdminClient{cc}
+}
+
+func (c *regionAGogoAdminClient) AddFences(ctx context.Context, in *AddFencesRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogoAdmin/AddFences", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoAdminClient) ReplaceFence(ctx context.Context, in *ReplaceFenceRequest, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogoAdmin/ReplaceFence", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *regionAGogoAdminClient) RemoveFence(ctx context.Context, in *FenceRef, opts ...grpc.CallOption) (*AdminResponse, error) {
+	out := new(AdminResponse)
+	err := grpc.Invoke(ctx, "/regionagogosvc.RegionAGogoAdmin/RemoveFence", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for RegionAGogoAdmin service
+
+type RegionAGogoAdminServer interface {
+	// Stores the fences of a GeoJSON Feature or FeatureCollection.
+	AddFences(context.Context, *AddFencesRequest) (*AdminResponse, error)
+	// Replaces a fence, referenced by its id or key, with a GeoJSON Feature.
+	ReplaceFence(context.Context, *ReplaceFenceRequest) (*AdminResponse, error)
+	// Removes a fence referenced by its id or key.
+	RemoveFence(context.Context, *FenceRef) (*AdminResponse, error)
+}
+
+func RegisterRegionAGogoAdminServer(s *grpc.Server, srv RegionAGogoAdminServer) {
+	s.RegisterService(&_RegionAGogoAdmin_serviceDesc, srv)
+}
+
+func _RegionAGogoAdmin_AddFences_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddFencesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoAdminServer).AddFences(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogoAdmin/AddFences",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoAdminServer).AddFences(ctx, req.(*AddFencesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogoAdmin_ReplaceFence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplaceFenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoAdminServer).ReplaceFence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogoAdmin/ReplaceFence",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoAdminServer).ReplaceFence(ctx, req.(*ReplaceFenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RegionAGogoAdmin_RemoveFence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FenceRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RegionAGogoAdminServer).RemoveFence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/regionagogosvc.RegionAGogoAdmin/RemoveFence",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RegionAGogoAdminServer).RemoveFence(ctx, req.(*FenceRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _RegionAGogoAdmin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "regionagogosvc.RegionAGogoAdmin",
+	HandlerType: (*RegionAGogoAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddFences",
+			Handler:    _RegionAGogoAdmin_AddFences_Handler,
+		},
+		{
+			MethodName: "ReplaceFence",
+			Handler:    _RegionAGogoAdmin_ReplaceFence_Handler,
+		},
+		{
+			MethodName: "RemoveFence",
+			Handler:    _RegionAGogoAdmin_RemoveFence_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "regionagogosvc.proto",
@@ -155,16 +1119,62 @@ var _RegionAGogo_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("regionagogosvc.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 162 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0x29, 0x4a, 0x4d, 0xcf,
-	0xcc, 0xcf, 0x4b, 0x4c, 0xcf, 0x4f, 0xcf, 0x2f, 0x2e, 0x4b, 0xd6, 0x2b, 0x28, 0xca, 0x2f, 0xc9,
-	0x17, 0xe2, 0x43, 0x15, 0x55, 0x72, 0xe4, 0x62, 0x0d, 0xc8, 0xcf, 0xcc, 0x2b, 0x11, 0x92, 0xe2,
-	0xe2, 0xc8, 0x49, 0x2c, 0xc9, 0x2c, 0x29, 0x4d, 0x49, 0x95, 0x60, 0x54, 0x60, 0xd4, 0x60, 0x0a,
-	0x82, 0xf3, 0x85, 0x64, 0xb8, 0x38, 0x73, 0xf2, 0xf3, 0xd2, 0x21, 0x92, 0x4c, 0x60, 0x49, 0x84,
-	0x80, 0x92, 0x0a, 0x17, 0x5f, 0x10, 0xd8, 0xd0, 0xa0, 0xd4, 0xe2, 0x82, 0xfc, 0xbc, 0xe2, 0x54,
-	0x21, 0x21, 0x2e, 0x96, 0xe4, 0x7c, 0xa8, 0x39, 0x9c, 0x41, 0x60, 0xb6, 0x51, 0x30, 0x17, 0x37,
-	0x44, 0x95, 0xa3, 0x7b, 0x7e, 0x7a, 0xbe, 0x90, 0x0b, 0x17, 0xa7, 0x7b, 0x6a, 0x09, 0x44, 0x44,
-	0x48, 0x54, 0x0f, 0xcd, 0xad, 0x60, 0x27, 0x49, 0xc9, 0xa1, 0x0b, 0xa3, 0x5a, 0xa3, 0xc4, 0x90,
-	0xc4, 0x06, 0xf6, 0x94, 0x31, 0x20, 0x00, 0x00, 0xff, 0xff, 0x6e, 0x12, 0x22, 0x2b, 0xec, 0x00,
-	0x00, 0x00,
+	// 912 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0xad, 0x56, 0xdd, 0x6e, 0xd3, 0x30,
+	0x14, 0x5e, 0xd2, 0x9f, 0xb5, 0xa7, 0xeb, 0x0f, 0x66, 0x4c, 0x55, 0x61, 0x0c, 0x82, 0x10, 0xd3,
+	0x04, 0x13, 0xda, 0x26, 0x36, 0x21, 0x24, 0x54, 0xd6, 0xb2, 0x45, 0x1b, 0x5d, 0xf1, 0x2a, 0xc1,
+	0x5d, 0x95, 0xb5, 0x5e, 0x17, 0x96, 0xc6, 0x25, 0x49, 0x27, 0x26, 0xee, 0x78, 0x00, 0x5e, 0x86,
+	0xb7, 0xe0, 0x86, 0x47, 0xe0, 0x55, 0x70, 0x1c, 0x27, 0x6d, 0xd2, 0x74, 0x1d, 0x83, 0xbb, 0xd8,
+	0x3e, 0xfe, 0xce, 0x77, 0xbe, 0xf3, 0xe3, 0xc0, 0xa2, 0x45, 0x7a, 0x3a, 0x35, 0xb5, 0x1e, 0xed,
+	0x51, 0xfb, 0xa2, 0xb3, 0x3e, 0xb0, 0xa8, 0x43, 0x51, 0x21, 0xbc, 0xab, 0xbc, 0x87, 0x54, 0x93,
+	0xea, 0xa6, 0x83, 0x2a, 0x90, 0x31, 0x34, 0x47, 0x77, 0x86, 0x5d, 0x52, 0x96, 0x1e, 0x48, 0xab,
+	0x32, 0x0e, 0xd6, 0xe8, 0x1e, 0x64, 0x0d, 0x6a, 0xf6, 0xbc, 0x43, 0x99, 0x1f, 0x8e, 0x36, 0x50,
+	0x01, 0x64, 0xbd, 0x5b, 0x4e, 0xb0, 0xed, 0x24, 0x66, 0x5f, 0xca, 0x36, 0xa4, 0x39, 0xa4, 0x8d,
+	0x9e, 0x41, 0x7a, 0xc0, 0xbf, 0x18, 0x62, 0x62, 0x35, 0xb7, 0x71, 0x67, 0x3d, 0xc2, 0x89, 0xdb,
+	0x61, 0x61, 0xa4, 0x6c, 0x41, 0x01, 0xf3, 0x73, 0x4c, 0xec, 0x01, 0x35, 0x6d, 0x82, 0x10, 0x24,
+	0x3b, 0x54, 0x10, 0xca, 0x62, 0xfe, 0x2d, 0xdc, 0xc9, 0x81, 0xbb, 0x03, 0x28, 0x7a, 0xb7, 0xec,
+	0xe0, 0xda, 0x0e, 0xcc, 0x7b, 0x8e, 0x7c, 0xc7, 0xf7, 0xa3, 0x8e, 0xc3, 0x7e, 0xb0, 0x6f, 0xae,
+	0xbc, 0x86, 0xe2, 0x5b, 0x62, 0x76, 0xc8, 0x01, 0xb9, 0xc4, 0xe4, 0xf3, 0x90, 0xd8, 0x0e, 0x2a,
+	0x41, 0xe2, 0x9c, 0x5c, 0x0a, 0x0a, 0xee, 0xa7, 0x2b, 0x55, 0x8f, 0xd0, 0x3e, 0x71, 0xac, 0x4b,
+	0xce, 0x23, 0x83, 0x83, 0xb5, 0xf2, 0x15, 0x0a, 0x0d, 0xa2, 0x59, 0xec, 0xa2, 0x7f, 0xff, 0xe6,
+	0xc2, 0x2e, 0x80, 0x74, 0xce, 0x75, 0xcd, 0x63, 0xe9, 0x1c, 0x3d, 0x84, 0x85, 0xbe, 0xf6, 0xa5,
+	0xdd, 0xd5, 0x6d, 0x47, 0x63, 0x0c, 0xcb, 0x49, 0x76, 0x20, 0xe1, 0x1c, 0xdb, 0xab, 0x89, 0x2d,
+	0xe5, 0xb7, 0x04, 0x29, 0x4e, 0x5f, 0x88, 0x24, 0xf9, 0x22, 0xf9, 0x41, 0xc8, 0xa3, 0x20, 0x36,
+	0x21, 0xd9, 0xd5, 0x1c, 0x8d, 0xe1, 0xbb, 0x02, 0xad, 0x44, 0x05, 0xe2, 0x30, 0xeb, 0x35, 0x66,
+	0x51, 0x37, 0x59, 0x5c, 0x98, 0x1b, 0xbb, 0xb1, 0x44, 0xfc, 0x07, 0x6b, 0xb4, 0x06, 0x29, 0x83,
+	0xd2, 0x81, 0x5d, 0x4e, 0x71, 0xc4, 0xc5, 0x28, 0xe2, 0x21, 0x3b, 0xc4, 0x9e, 0x49, 0x65, 0x1b,
+	0xb2, 0x01, 0x74, 0x8c, 0xc0, 0x8b, 0x90, 0xba, 0xd0, 0x8c, 0x21, 0x11, 0x7c, 0xbd, 0xc5, 0x4b,
+	0x79, 0x47, 0x62, 0xf9, 0x29, 0x70, 0x66, 0xa3, 0x5c, 0xb3, 0x1a, 0x3b, 0xe5, 0x3b, 0xd3, 0x6a,
+	0x8c, 0xdb, 0x63, 0x61, 0xa4, 0x7c, 0x97, 0x20, 0xef, 0x23, 0xfc, 0x6b, 0x7e, 0x9e, 0x40, 0xb1,
+	0x3f, 0x34, 0x1c, 0x7d, 0x60, 0x90, 0xb6, 0xe0, 0x90, 0xe0, 0xe5, 0x50, 0xf0, 0xb7, 0x3d, 0x4f,
+	0xa1, 0x82, 0x49, 0x46, 0x0a, 0x46, 0x85, 0xa4, 0xab, 0xcc, 0x5f, 0xf6, 0x8a, 0xdb, 0x19, 0x67,
+	0xd4, 0x20, 0xa2, 0xfe, 0xf8, 0xb7, 0xf2, 0x4a, 0x88, 0xa3, 0xd6, 0xfc, 0xd8, 0xa2, 0x65, 0x70,
+	0x55, 0xe5, 0xfe, 0x92, 0x20, 0x87, 0x49, 0x27, 0xa8, 0xdb, 0x17, 0x90, 0x1b, 0x0e, 0x06, 0xc4,
+	0x6a, 0x5b, 0x7a, 0xef, 0xcc, 0xe1, 0x20, 0x53, 0x59, 0x01, 0xb7, 0xc4, 0xae, 0xa1, 0x7b, 0xef,
+	0x84, 0x3a, 0x0e, 0xed, 0xb7, 0x0d, 0x72, 0xea, 0x70, 0x37, 0xd3, 0xef, 0x79, 0x96, 0x87, 0xcc,
+	0x10, 0x6d, 0x41, 0xc6, 0x22, 0xae, 0xf2, 0xd4, 0xe4, 0x32, 0x16, 0x36, 0xca, 0x93, 0x5d, 0xeb,
+	0x9d, 0xe3, 0xc0, 0xf2, 0x4a, 0x69, 0x7f, 0xb0, 0x5c, 0x63, 0xad, 0xab, 0x0f, 0xff, 0x43, 0xae,
+	0x97, 0x20, 0x6d, 0x71, 0x28, 0xce, 0x4d, 0xc2, 0x62, 0x15, 0x62, 0x9d, 0xbc, 0x11, 0xeb, 0x54,
+	0x84, 0xf5, 0x53, 0x28, 0x55, 0xbb, 0xdd, 0x70, 0x8d, 0x96, 0x61, 0x9e, 0x9d, 0x7f, 0xb2, 0x99,
+	0x13, 0xaf, 0x4d, 0xfc, 0x25, 0xb3, 0xce, 0x78, 0x05, 0x4e, 0x4e, 0x67, 0x37, 0xbd, 0xd2, 0x86,
+	0xdb, 0x98, 0x0c, 0x0c, 0xad, 0x43, 0xc4, 0x25, 0x0f, 0x7e, 0x1d, 0x52, 0xbc, 0x7e, 0x45, 0x92,
+	0xcb, 0xf1, 0x2d, 0x44, 0x4e, 0xb1, 0x67, 0x36, 0x4e, 0x47, 0x0e, 0xd3, 0x79, 0x0c, 0xf9, 0x6a,
+	0xb7, 0xaf, 0x8f, 0x26, 0x38, 0x6b, 0xe5, 0x0e, 0x1d, 0x9a, 0x5e, 0xfd, 0xe4, 0xb1, 0xb7, 0x58,
+	0xab, 0x43, 0xc6, 0x57, 0x05, 0x15, 0x21, 0x57, 0x6d, 0x36, 0xf1, 0xd1, 0x47, 0xf5, 0x5d, 0xb5,
+	0x55, 0x2f, 0xcd, 0xb1, 0x30, 0x40, 0x6d, 0xb4, 0xea, 0xf8, 0xb8, 0xbe, 0xdb, 0x3a, 0x2e, 0x49,
+	0x08, 0x20, 0xfd, 0x41, 0x6d, 0xed, 0xab, 0x8d, 0x92, 0xcc, 0x46, 0x62, 0x66, 0xf7, 0xa8, 0xd1,
+	0xaa, 0xaa, 0x8d, 0xe3, 0x52, 0x62, 0xe3, 0x67, 0xca, 0x2d, 0x59, 0x97, 0x6a, 0x75, 0x8f, 0x51,
+	0x45, 0x35, 0xc8, 0xee, 0x11, 0xc7, 0xdb, 0x41, 0xf1, 0x25, 0x57, 0x99, 0xf1, 0x14, 0x28, 0x73,
+	0xe8, 0x90, 0xa3, 0x88, 0xd6, 0x5d, 0x8e, 0xd5, 0xc2, 0x4f, 0xcc, 0x24, 0x5a, 0x78, 0x3a, 0x31,
+	0xb4, 0x3d, 0x80, 0x80, 0x93, 0x8d, 0x96, 0x62, 0x49, 0xd9, 0x95, 0x95, 0x78, 0x56, 0x76, 0x88,
+	0x56, 0xfe, 0xd8, 0xb1, 0x88, 0xd6, 0xf7, 0xb1, 0x6e, 0x1a, 0xe0, 0xaa, 0xf4, 0x5c, 0x42, 0x2a,
+	0xe4, 0xfd, 0x20, 0xdf, 0x5c, 0xb2, 0xd7, 0x0e, 0xc5, 0xbf, 0x00, 0xa3, 0x77, 0xb0, 0x12, 0x3f,
+	0x58, 0x79, 0x84, 0x0b, 0x23, 0x28, 0xb5, 0x86, 0xe2, 0x35, 0x09, 0x86, 0xd2, 0x74, 0xa0, 0x26,
+	0x14, 0x03, 0xe1, 0x55, 0xd3, 0x9d, 0x45, 0xe8, 0xee, 0x64, 0x30, 0xc1, 0x84, 0xba, 0x86, 0xf8,
+	0x2d, 0xb8, 0x35, 0x8e, 0xe8, 0xb5, 0xec, 0x44, 0x4a, 0x43, 0x33, 0xe2, 0x5a, 0xa8, 0x25, 0x86,
+	0x2a, 0x9e, 0x79, 0x51, 0x27, 0x13, 0xb7, 0xc2, 0x7f, 0x01, 0xb3, 0x51, 0x37, 0xbe, 0xc9, 0x50,
+	0x1a, 0x2b, 0x66, 0xde, 0x46, 0xa8, 0x01, 0xd9, 0x60, 0x18, 0xa0, 0x07, 0x51, 0x8c, 0xe8, 0x9c,
+	0xa8, 0x2c, 0x4f, 0x5a, 0x8c, 0x35, 0x23, 0xa7, 0xbe, 0x30, 0x3e, 0x00, 0xd0, 0xa3, 0x49, 0x7d,
+	0x27, 0xc6, 0xc3, 0x6c, 0xd4, 0x7d, 0xb7, 0x0d, 0xfb, 0xf4, 0x42, 0x80, 0x4e, 0x9d, 0x1f, 0x33,
+	0x91, 0x4e, 0xd2, 0xfc, 0x2f, 0x75, 0xf3, 0x0f, 0xe8, 0xbd, 0x73, 0xdf, 0xbd, 0x0a, 0x00, 0x00,
 }
@@ -0,0 +1,347 @@
+package regionagogo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"unicode/utf8"
+
+	"github.com/kpawlik/geojson"
+)
+
+// An Esri shapefile is read sequentially, the .shp geometries and the .dbf attributes in lockstep,
+// the nth dbf record holding the attributes of the nth shape, the .shx index is not needed.
+const (
+	shpFileCode  = 9994
+	shpHeaderLen = 100
+
+	// shape types
+	shpNull     = 0
+	shpPolygon  = 5
+	shpPolygonZ = 15
+	shpPolygonM = 25
+
+	// the fixed part of a polygon record: shape type, bounding box, parts and points counts
+	shpPolygonLen = 44
+
+	dbfHeaderLen     = 32
+	dbfFieldLen      = 32
+	dbfFieldsEnd     = 0x0d
+	dbfEOF           = 0x1a
+	dbfDeletedRecord = '*'
+)
+
+var (
+	// ErrInvalidShapefile is returned when the shapefile is malformed or its shapes are not polygons
+	ErrInvalidShapefile = errors.New("invalid shapefile, expecting polygons")
+
+	// ErrProjectedShapefile is returned when the shapefile coordinates are not longitudes and latitudes,
+	// the .prj is not read, a shapefile in a projected coordinate system has to be reprojected to WGS84 first
+	ErrProjectedShapefile = errors.New("invalid shapefile, coordinates out of the longitude and latitude range, expecting WGS84")
+)
+
+// shpReader reads the records of a .shp file
+type shpReader struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func newShpReader(r io.Reader) (*shpReader, error) {
+	var h [shpHeaderLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(h[:]) != shpFileCode {
+		return nil, ErrInvalidShapefile
+	}
+
+	switch binary.LittleEndian.Uint32(h[32:]) {
+	case shpNull, shpPolygon, shpPolygonZ, shpPolygonM:
+	default:
+		return nil, ErrInvalidShapefile
+	}
+
+	// the bounding box of all the shapes, a projected shapefile is refused before the first record
+	for off := 36; off < 68; off += 16 {
+		if !validLngLat(shpFloat(h[off:]), shpFloat(h[off+8:])) {
+			return nil, ErrProjectedShapefile
+		}
+	}
+
+	return &shpReader{r: r}, nil
+}
+
+// shpFloat reads a little endian float64
+func shpFloat(b []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+// validLngLat returns true if lng and lat are in the longitude and latitude range
+func validLngLat(lng, lat float64) bool {
+	return lng >= -180 && lng <= 180 && lat >= -90 && lat <= 90
+}
+
+// next returns the polygons of the next record, nil for a null shape, io.EOF after the last record
+func (sr *shpReader) next() ([]geojson.MultiLine, error) {
+	var h [8]byte
+	if _, err := io.ReadFull(sr.r, h[:]); err != nil {
+		return nil, err
+	}
+
+	// the content length is in 16 bits words, the buffer only grows with the bytes actually read
+	// so a corrupted length can't allocate more than the file size
+	length := int64(binary.BigEndian.Uint32(h[4:])) * 2
+	sr.buf.Reset()
+	if _, err := io.CopyN(&sr.buf, sr.r, length); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	b := sr.buf.Bytes()
+
+	if len(b) < 4 {
+		return nil, ErrInvalidShapefile
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case shpNull:
+		return nil, nil
+	case shpPolygon, shpPolygonZ, shpPolygonM:
+	default:
+		return nil, ErrInvalidShapefile
+	}
+
+	// Z and M values follow the points, they are ignored
+	if len(b) < shpPolygonLen {
+		return nil, ErrInvalidShapefile
+	}
+	numParts := int(binary.LittleEndian.Uint32(b[36:]))
+	numPoints := int(binary.LittleEndian.Uint32(b[40:]))
+	pointsOffset := shpPolygonLen + 4*numParts
+	if numParts < 0 || numPoints < 0 || len(b) < pointsOffset || (len(b)-pointsOffset)/16 < numPoints {
+		return nil, ErrInvalidShapefile
+	}
+
+	rings := make([]geojson.Coordinates, numParts)
+	for p := range rings {
+		start := int(binary.LittleEndian.Uint32(b[shpPolygonLen+4*p:]))
+		end := numPoints
+		if p < numParts-1 {
+			end = int(binary.LittleEndian.Uint32(b[shpPolygonLen+4*(p+1):]))
+		}
+		if start < 0 || start > end || end > numPoints {
+			return nil, ErrInvalidShapefile
+		}
+
+		ring := make(geojson.Coordinates, end-start)
+		for j := range ring {
+			pt := b[pointsOffset+16*(start+j):]
+			lng, lat := shpFloat(pt), shpFloat(pt[8:])
+			if !validLngLat(lng, lat) {
+				return nil, ErrProjectedShapefile
+			}
+			ring[j] = geojson.Coordinate{geojson.CoordType(lng), geojson.CoordType(lat)}
+		}
+		rings[p] = ring
+	}
+
+	return shapePolygons(rings), nil
+}
+
+// shapePolygons groups the rings of a shape into polygons,
+// exterior rings are clockwise, holes are counter clockwise and attached to the exterior ring containing them
+func shapePolygons(rings []geojson.Coordinates) []geojson.MultiLine {
+	var polygons []geojson.MultiLine
+	var holes []geojson.Coordinates
+	for _, ring := range rings {
+		if len(ring) < 4 {
+			continue
+		}
+		if isClockwisePolygon(ring) {
+			polygons = append(polygons, geojson.MultiLine{ring})
+			continue
+		}
+		holes = append(holes, ring)
+	}
+
+	// a shape with only counter clockwise rings was written with the wrong orientation
+	if len(polygons) == 0 {
+		for _, hole := range holes {
+			polygons = append(polygons, geojson.MultiLine{hole})
+		}
+		return polygons
+	}
+
+	for _, hole := range holes {
+		pi := len(polygons) - 1
+		for j, p := range polygons {
+			if ringContains(p[0], hole[0]) {
+				pi = j
+				break
+			}
+		}
+		polygons[pi] = append(polygons[pi], hole)
+	}
+
+	return polygons
+}
+
+// ringContains returns true if the planar ring contains c
+func ringContains(ring geojson.Coordinates, c geojson.Coordinate) bool {
+	x, y := float64(c[0]), float64(c[1])
+	var inside bool
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := float64(ring[i][0]), float64(ring[i][1])
+		xj, yj := float64(ring[j][0]), float64(ring[j][1])
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// dbfField is a dbf column name and width
+type dbfField struct {
+	name   string
+	length int
+}
+
+// dbfReader reads the records of a .dbf file
+type dbfReader struct {
+	r      io.Reader
+	fields []dbfField
+	record []byte
+}
+
+func newDbfReader(r io.Reader) (*dbfReader, error) {
+	var h [dbfHeaderLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return nil, err
+	}
+	headerLen := int(binary.LittleEndian.Uint16(h[8:]))
+	recordLen := int(binary.LittleEndian.Uint16(h[10:]))
+	if headerLen <= dbfHeaderLen || recordLen < 1 {
+		return nil, ErrInvalidShapefile
+	}
+
+	desc := make([]byte, headerLen-dbfHeaderLen)
+	if _, err := io.ReadFull(r, desc); err != nil {
+		return nil, err
+	}
+
+	var fields []dbfField
+	width := 1 // the deletion flag
+	for off := 0; off+dbfFieldLen <= len(desc) && desc[off] != dbfFieldsEnd; off += dbfFieldLen {
+		name := desc[off : off+11]
+		if n := bytes.IndexByte(name, 0); n >= 0 {
+			name = name[:n]
+		}
+		f := dbfField{name: string(name), length: int(desc[off+16])}
+		width += f.length
+		fields = append(fields, f)
+	}
+	if width > recordLen {
+		return nil, ErrInvalidShapefile
+	}
+
+	return &dbfReader{r: r, fields: fields, record: make([]byte, recordLen)}, nil
+}
+
+// next returns the non blank attributes of the next record and if it is deleted, io.EOF after the last record
+func (dr *dbfReader) next() (map[string]interface{}, bool, error) {
+	if _, err := io.ReadFull(dr.r, dr.record); err != nil {
+		if err == io.ErrUnexpectedEOF && dr.record[0] == dbfEOF {
+			return nil, false, io.EOF
+		}
+		return nil, false, err
+	}
+	if dr.record[0] == dbfEOF {
+		return nil, false, io.EOF
+	}
+
+	properties := make(map[string]interface{})
+	off := 1
+	for _, f := range dr.fields {
+		if v := dbfString(dr.record[off : off+f.length]); v != "" {
+			properties[f.name] = v
+		}
+		off += f.length
+	}
+
+	return properties, dr.record[0] == dbfDeletedRecord, nil
+}
+
+// dbfString returns a dbf value without its padding
+// values are expected in UTF-8, invalid UTF-8 is read as Latin-1 the encoding of many older files
+func dbfString(b []byte) string {
+	b = bytes.Trim(b, " \x00")
+	if utf8.Valid(b) {
+		return string(b)
+	}
+
+	rs := make([]rune, len(b))
+	for i, c := range b {
+		rs[i] = rune(c)
+	}
+	return string(rs)
+}
+
+// streamShapefile reads the polygons of shp with their dbf attributes calling fn for each shape
+// dbf can be nil to import the shapes without attributes, null shapes and deleted records are skipped
+func streamShapefile(shp, dbf io.Reader, fn func(*geojson.Feature) error) error {
+	sr, err := newShpReader(shp)
+	if err != nil {
+		return err
+	}
+
+	var dr *dbfReader
+	if dbf != nil {
+		dr, err = newDbfReader(dbf)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		polygons, err := sr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		properties := make(map[string]interface{})
+		if dr != nil {
+			var deleted bool
+			properties, deleted, err = dr.next()
+			if err == io.EOF {
+				// less attributes records than shapes
+				return ErrInvalidShapefile
+			}
+			if err != nil {
+				return err
+			}
+			if deleted {
+				continue
+			}
+		}
+
+		if len(polygons) == 0 {
+			log.Println("null shape", properties)
+			continue
+		}
+
+		f := &geojson.Feature{
+			Type:       "Feature",
+			Geometry:   &geojson.MultiPolygon{Type: "MultiPolygon", Coordinates: polygons},
+			Properties: properties,
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
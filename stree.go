@@ -9,6 +9,9 @@ import (
 type S2Interval struct {
 	s2.CellID
 	LoopIDs []uint64
+
+	// InteriorLoopIDs are the loops entirely containing the cell
+	InteriorLoopIDs []uint64
 }
 
 // LowAtDimension returns an integer representing the lower bound
@@ -0,0 +1,380 @@
+package regionagogo
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kpawlik/geojson"
+)
+
+// WKT and WKB polygons parsers, the PostGIS extended forms EWKT and EWKB are accepted
+// with the SRID 4326 only, coordinates are expected as lng lat, Z and M values are dropped
+
+var (
+	// ErrInvalidWKT is returned for a malformed WKT or a WKT geometry other than POLYGON or MULTIPOLYGON
+	ErrInvalidWKT = errors.New("invalid WKT, expecting a POLYGON or a MULTIPOLYGON")
+
+	// ErrInvalidWKB is returned for a malformed WKB or a WKB geometry other than Polygon or MultiPolygon
+	ErrInvalidWKB = errors.New("invalid WKB, expecting a Polygon or a MultiPolygon")
+
+	// ErrUnsupportedSRID is returned for an EWKT or an EWKB with a SRID other than 4326
+	ErrUnsupportedSRID = errors.New("unsupported SRID, expecting 4326")
+
+	// ErrOutOfRangeCoordinates is returned for coordinates out of the longitude and latitude range,
+	// a geometry in a projected coordinate system has to be reprojected to WGS84 first
+	ErrOutOfRangeCoordinates = errors.New("coordinates out of the longitude and latitude range, expecting WGS84")
+)
+
+// wgs84SRID is the SRID of WGS84 longitudes and latitudes
+const wgs84SRID = 4326
+
+// closedRing returns true if the ring ends with its first point
+func closedRing(ring geojson.Coordinates) bool {
+	last := len(ring) - 1
+	return last > 0 && ring[0][0] == ring[last][0] && ring[0][1] == ring[last][1]
+}
+
+// ParseWKT returns the polygons of a WKT POLYGON or MULTIPOLYGON, for each polygon its rings
+// the first ring being the exterior ring, an EMPTY geometry has no polygons
+func ParseWKT(wkt string) ([]geojson.MultiLine, error) {
+	// EWKT is prefixed by its SRID, SRID=4326;POLYGON(...)
+	if strings.HasPrefix(strings.ToUpper(wkt), "SRID=") {
+		i := strings.IndexByte(wkt, ';')
+		if i < 0 {
+			return nil, ErrInvalidWKT
+		}
+		srid, err := strconv.Atoi(strings.TrimSpace(wkt[5:i]))
+		if err != nil {
+			return nil, ErrInvalidWKT
+		}
+		if srid != wgs84SRID {
+			return nil, ErrUnsupportedSRID
+		}
+		wkt = wkt[i+1:]
+	}
+
+	p := &wktParser{s: wkt}
+	typ := p.word()
+
+	// Z, M or ZM dimensions, the extra values are skipped with the points
+	if p.peekWord() != "EMPTY" && p.peek() != '(' {
+		p.word()
+	}
+
+	var polygons []geojson.MultiLine
+	switch typ {
+	case "POLYGON":
+		rings, err := p.polygon()
+		if err != nil {
+			return nil, err
+		}
+		if rings != nil {
+			polygons = append(polygons, rings)
+		}
+	case "MULTIPOLYGON":
+		if p.peekWord() == "EMPTY" {
+			p.word()
+			break
+		}
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		for {
+			rings, err := p.polygon()
+			if err != nil {
+				return nil, err
+			}
+			if rings != nil {
+				polygons = append(polygons, rings)
+			}
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidWKT
+	}
+
+	if p.peek() != 0 {
+		return nil, ErrInvalidWKT
+	}
+
+	return polygons, nil
+}
+
+// wktParser reads a WKT text from pos
+type wktParser struct {
+	s   string
+	pos int
+}
+
+// peek returns the next non space character, 0 at the end of the text
+func (p *wktParser) peek() byte {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// word reads the next word in upper case
+func (p *wktParser) word() string {
+	p.peek()
+	start := p.pos
+	for p.pos < len(p.s) && (p.s[p.pos]|0x20 >= 'a' && p.s[p.pos]|0x20 <= 'z') {
+		p.pos++
+	}
+	return strings.ToUpper(p.s[start:p.pos])
+}
+
+// peekWord returns the next word without reading it
+func (p *wktParser) peekWord() string {
+	pos := p.pos
+	w := p.word()
+	p.pos = pos
+	return w
+}
+
+func (p *wktParser) expect(c byte) error {
+	if p.peek() != c {
+		return ErrInvalidWKT
+	}
+	p.pos++
+	return nil
+}
+
+// polygon reads a list of rings, nil for EMPTY
+func (p *wktParser) polygon() (geojson.MultiLine, error) {
+	if p.peekWord() == "EMPTY" {
+		p.word()
+		return nil, nil
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var rings geojson.MultiLine
+	for {
+		ring, err := p.ring()
+		if err != nil {
+			return nil, err
+		}
+		rings = append(rings, ring)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	return rings, nil
+}
+
+// ring reads a list of points, only the first two values of each point are kept
+func (p *wktParser) ring() (geojson.Coordinates, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	var ring geojson.Coordinates
+	for {
+		var values []float64
+		for c := p.peek(); c != ',' && c != ')'; c = p.peek() {
+			start := p.pos
+			for p.pos < len(p.s) && strings.IndexByte("+-.0123456789eE", p.s[p.pos]) >= 0 {
+				p.pos++
+			}
+			v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+			if err != nil {
+				return nil, ErrInvalidWKT
+			}
+			values = append(values, v)
+		}
+		if len(values) < 2 {
+			return nil, ErrInvalidWKT
+		}
+		if !validLngLat(values[0], values[1]) {
+			return nil, ErrOutOfRangeCoordinates
+		}
+		ring = append(ring, geojson.Coordinate{geojson.CoordType(values[0]), geojson.CoordType(values[1])})
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	if !closedRing(ring) {
+		return nil, ErrInvalidWKT
+	}
+	return ring, nil
+}
+
+// WKB geometry types and EWKB flags
+const (
+	wkbPolygon      = 3
+	wkbMultiPolygon = 6
+
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// ParseWKB returns the polygons of a WKB Polygon or MultiPolygon, for each polygon its rings
+// the first ring being the exterior ring
+func ParseWKB(wkb []byte) ([]geojson.MultiLine, error) {
+	r := &wkbReader{b: wkb}
+	polygons, err := r.geometry(true)
+	if err != nil {
+		return nil, err
+	}
+	if r.off != len(r.b) {
+		return nil, ErrInvalidWKB
+	}
+	return polygons, nil
+}
+
+// wkbReader reads a WKB from off
+type wkbReader struct {
+	b     []byte
+	off   int
+	order binary.ByteOrder
+}
+
+func (r *wkbReader) uint32() (uint32, error) {
+	if len(r.b)-r.off < 4 {
+		return 0, ErrInvalidWKB
+	}
+	v := r.order.Uint32(r.b[r.off:])
+	r.off += 4
+	return v, nil
+}
+
+// geometry reads a Polygon, or a MultiPolygon when multi is true
+func (r *wkbReader) geometry(multi bool) ([]geojson.MultiLine, error) {
+	if r.off >= len(r.b) {
+		return nil, ErrInvalidWKB
+	}
+	// each geometry, even nested, has its own byte order
+	switch r.b[r.off] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return nil, ErrInvalidWKB
+	}
+	r.off++
+
+	typ, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	dims := 2
+	if typ&ewkbZ != 0 {
+		dims++
+	}
+	if typ&ewkbM != 0 {
+		dims++
+	}
+	if typ&ewkbSRID != 0 {
+		srid, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		if srid != wgs84SRID {
+			return nil, ErrUnsupportedSRID
+		}
+	}
+	typ &^= ewkbZ | ewkbM | ewkbSRID
+
+	// ISO WKB types, 1000 for Z, 2000 for M and 3000 for ZM
+	switch typ / 1000 {
+	case 1, 2:
+		dims = 3
+	case 3:
+		dims = 4
+	}
+
+	switch typ % 1000 {
+	case wkbPolygon:
+		rings, err := r.polygon(dims)
+		if err != nil {
+			return nil, err
+		}
+		if len(rings) == 0 {
+			return nil, nil
+		}
+		return []geojson.MultiLine{rings}, nil
+	case wkbMultiPolygon:
+		if !multi {
+			return nil, ErrInvalidWKB
+		}
+		n, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		var polygons []geojson.MultiLine
+		for j := uint32(0); j < n; j++ {
+			p, err := r.geometry(false)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, p...)
+		}
+		return polygons, nil
+	default:
+		return nil, ErrInvalidWKB
+	}
+}
+
+// polygon reads the rings of a polygon made of points of dims values
+func (r *wkbReader) polygon(dims int) (geojson.MultiLine, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+
+	var rings geojson.MultiLine
+	for j := uint32(0); j < n; j++ {
+		count, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		// checked before allocating, a corrupted count can't be larger than the input
+		if uint64(count)*uint64(dims*8) > uint64(len(r.b)-r.off) {
+			return nil, ErrInvalidWKB
+		}
+
+		ring := make(geojson.Coordinates, count)
+		for k := range ring {
+			lng := math.Float64frombits(r.order.Uint64(r.b[r.off:]))
+			lat := math.Float64frombits(r.order.Uint64(r.b[r.off+8:]))
+			if !validLngLat(lng, lat) {
+				return nil, ErrOutOfRangeCoordinates
+			}
+			ring[k] = geojson.Coordinate{geojson.CoordType(lng), geojson.CoordType(lat)}
+			r.off += dims * 8
+		}
+		if !closedRing(ring) {
+			return nil, ErrInvalidWKB
+		}
+		rings = append(rings, ring)
+	}
+	return rings, nil
+}
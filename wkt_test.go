@@ -0,0 +1,164 @@
+package regionagogo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/kpawlik/geojson"
+	"github.com/stretchr/testify/require"
+)
+
+// ringsCount returns the number of rings of each polygon
+func ringsCount(polygons []geojson.MultiLine) []int {
+	var counts []int
+	for _, rings := range polygons {
+		counts = append(counts, len(rings))
+	}
+	return counts
+}
+
+func TestParseWKT(t *testing.T) {
+	tests := []struct {
+		name  string
+		wkt   string
+		rings []int
+		err   error
+	}{
+		{"polygon", "POLYGON((0 0,1 0,1 1,0 1,0 0))", []int{1}, nil},
+		{"polygon with a hole", "POLYGON((0 0,4 0,4 4,0 4,0 0),(1 1,2 1,2 2,1 2,1 1))", []int{2}, nil},
+		{"multipolygon", "MULTIPOLYGON(((0 0,1 0,1 1,0 1,0 0)),((2 2,3 2,3 3,2 3,2 2)))", []int{1, 1}, nil},
+		{"lower case and spaces", " polygon ( ( 0 0 , 1 0 , 1 1 , 0 1 , 0 0 ) ) ", []int{1}, nil},
+		{"z values", "POLYGON Z ((0 0 5,1 0 5,1 1 5,0 1 5,0 0 5))", []int{1}, nil},
+		{"zm values", "MULTIPOLYGON ZM (((0 0 5 1,1 0 5 1,1 1 5 1,0 1 5 1,0 0 5 1)))", []int{1}, nil},
+		{"empty polygon", "POLYGON EMPTY", nil, nil},
+		{"empty multipolygon", "MULTIPOLYGON EMPTY", nil, nil},
+		{"ewkt", "SRID=4326;POLYGON((0 0,1 0,1 1,0 1,0 0))", []int{1}, nil},
+		{"ewkt other srid", "SRID=3857;POLYGON((0 0,1 0,1 1,0 1,0 0))", nil, ErrUnsupportedSRID},
+		{"ewkt invalid srid", "SRID=wgs84;POLYGON((0 0,1 0,1 1,0 1,0 0))", nil, ErrInvalidWKT},
+		{"ewkt without separator", "SRID=4326 POLYGON((0 0,1 0,1 1,0 1,0 0))", nil, ErrInvalidWKT},
+		{"point", "POINT(1 2)", nil, ErrInvalidWKT},
+		{"empty text", "", nil, ErrInvalidWKT},
+		{"missing parenthesis", "POLYGON((0 0,1 0,1 1,0 1,0 0)", nil, ErrInvalidWKT},
+		{"invalid number", "POLYGON((0 0,1 a,1 1,0 1,0 0))", nil, ErrInvalidWKT},
+		{"single value", "POLYGON((0 0,1,1 1,0 1,0 0))", nil, ErrInvalidWKT},
+		{"trailing text", "POLYGON((0 0,1 0,1 1,0 1,0 0)) POINT", nil, ErrInvalidWKT},
+		{"unclosed ring", "POLYGON((0 0,1 0,1 1,0 1))", nil, ErrInvalidWKT},
+		{"unclosed hole", "POLYGON((0 0,4 0,4 4,0 4,0 0),(1 1,2 1,2 2,1 2))", nil, ErrInvalidWKT},
+		{"projected coordinates", "POLYGON((500000 0,500001 0,500001 1,500000 1,500000 0))", nil, ErrOutOfRangeCoordinates},
+		{"latitude out of range", "POLYGON((0 89,1 89,1 91,0 91,0 89))", nil, ErrOutOfRangeCoordinates},
+	}
+
+	for _, test := range tests {
+		polygons, err := ParseWKT(test.wkt)
+		require.Equal(t, test.err, err, test.name)
+		require.Equal(t, test.rings, ringsCount(polygons), test.name)
+	}
+
+	polygons, err := ParseWKT("POLYGON((0 0,1 0,1 1,0 1,0 0))")
+	require.NoError(t, err)
+	require.Equal(t, geojson.Coordinate{1, 0}, polygons[0][0][1])
+}
+
+// wkbPolygons encodes polygons as WKB, a Polygon for a single polygon, a MultiPolygon otherwise,
+// typ flags are added to the geometry types, points are made of dims values, the extra ones are 0
+func wkbPolygons(order binary.ByteOrder, typ uint32, srid uint32, dims int, polygons [][][][2]float64) []byte {
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		binary.Write(&buf, order, v)
+	}
+	// nested geometries have no SRID
+	header := func(geomType uint32, srid uint32) {
+		if order == binary.BigEndian {
+			write(uint8(0))
+		} else {
+			write(uint8(1))
+		}
+		if srid != 0 {
+			write(geomType | typ | ewkbSRID)
+			write(srid)
+			return
+		}
+		write(geomType | typ)
+	}
+
+	polygon := func(rings [][][2]float64) {
+		write(uint32(len(rings)))
+		for _, ring := range rings {
+			write(uint32(len(ring)))
+			for _, c := range ring {
+				write(c)
+				for d := 2; d < dims; d++ {
+					write(float64(0))
+				}
+			}
+		}
+	}
+
+	if len(polygons) == 1 {
+		header(wkbPolygon, srid)
+		polygon(polygons[0])
+		return buf.Bytes()
+	}
+
+	header(wkbMultiPolygon, srid)
+	write(uint32(len(polygons)))
+	for _, rings := range polygons {
+		header(wkbPolygon, 0)
+		polygon(rings)
+	}
+	return buf.Bytes()
+}
+
+func TestParseWKB(t *testing.T) {
+	square := [][2]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}
+	hole := [][2]float64{{0.2, 0.2}, {0.4, 0.2}, {0.4, 0.4}, {0.2, 0.4}, {0.2, 0.2}}
+	far := [][2]float64{{10, 10}, {11, 10}, {11, 11}, {10, 11}, {10, 10}}
+	polygon := [][][][2]float64{{square, hole}}
+	multi := [][][][2]float64{{square}, {far}}
+	le, be := binary.LittleEndian, binary.BigEndian
+
+	valid := wkbPolygons(le, 0, 0, 2, polygon)
+	corrupt := append([]byte{}, valid...)
+	// the count of the exterior ring points
+	binary.LittleEndian.PutUint32(corrupt[9:], math.MaxUint32)
+
+	tests := []struct {
+		name  string
+		wkb   []byte
+		rings []int
+		err   error
+	}{
+		{"polygon", valid, []int{2}, nil},
+		{"big endian polygon", wkbPolygons(be, 0, 0, 2, polygon), []int{2}, nil},
+		{"multipolygon", wkbPolygons(le, 0, 0, 2, multi), []int{1, 1}, nil},
+		{"big endian multipolygon", wkbPolygons(be, 0, 0, 2, multi), []int{1, 1}, nil},
+		{"ewkb", wkbPolygons(le, 0, 4326, 2, multi), []int{1, 1}, nil},
+		{"ewkb z", wkbPolygons(le, ewkbZ, 4326, 3, polygon), []int{2}, nil},
+		{"ewkb zm", wkbPolygons(le, ewkbZ|ewkbM, 0, 4, multi), []int{1, 1}, nil},
+		{"iso z", wkbPolygons(le, 1000, 0, 3, polygon), []int{2}, nil},
+		{"iso zm", wkbPolygons(be, 3000, 0, 4, multi), []int{1, 1}, nil},
+		{"empty polygon", wkbPolygons(le, 0, 0, 2, [][][][2]float64{{}}), nil, nil},
+		{"ewkb other srid", wkbPolygons(le, 0, 3857, 2, polygon), nil, ErrUnsupportedSRID},
+		{"empty input", nil, nil, ErrInvalidWKB},
+		{"invalid byte order", append([]byte{2}, valid[1:]...), nil, ErrInvalidWKB},
+		{"point", []byte{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, nil, ErrInvalidWKB},
+		{"truncated", valid[:len(valid)-8], nil, ErrInvalidWKB},
+		{"trailing bytes", append(append([]byte{}, valid...), 0), nil, ErrInvalidWKB},
+		{"corrupt points count", corrupt, nil, ErrInvalidWKB},
+		{"unclosed ring", wkbPolygons(le, 0, 0, 2, [][][][2]float64{{square[:4]}}), nil, ErrInvalidWKB},
+		{"projected coordinates", wkbPolygons(le, 0, 0, 2, [][][][2]float64{{{{500000, 0}, {500001, 0}, {500001, 1}, {500000, 0}}}}), nil, ErrOutOfRangeCoordinates},
+		{"nan coordinates", wkbPolygons(le, 0, 0, 2, [][][][2]float64{{{{math.NaN(), 0}, {1, 0}, {1, 1}, {math.NaN(), 0}}}}), nil, ErrOutOfRangeCoordinates},
+	}
+
+	for _, test := range tests {
+		polygons, err := ParseWKB(test.wkb)
+		require.Equal(t, test.err, err, test.name)
+		require.Equal(t, test.rings, ringsCount(polygons), test.name)
+	}
+
+	polygons, err := ParseWKB(wkbPolygons(be, 0, 0, 2, polygon))
+	require.NoError(t, err)
+	require.Equal(t, geojson.Coordinate{0.4, 0.2}, polygons[0][1][1])
+}